@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+func runBlock(ctx context.Context, args []string) error {
+	fs := newFlagSet("block", "<host>...")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, host := range fs.Args() {
+		if host == "" || strings.ContainsAny(host, "/:") {
+			return fmt.Errorf("invalid host %q: give a bare host name such as example.com", host)
+		}
+		if err := store.SaveCommand(ctx, storage.CommandBlock, strings.ToLower(host)); err != nil {
+			return fmt.Errorf("couldn't block %q: %w", host, err)
+		}
+		slog.Info("host block sent to running crawls", slog.String("host", host))
+	}
+
+	return nil
+}
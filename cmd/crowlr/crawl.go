@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/admin"
+	"github.com/devraulu/crowlr/pkg/cluster"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/crawler"
+	"github.com/devraulu/crowlr/pkg/dnscache"
+	"github.com/devraulu/crowlr/pkg/process"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+func runCrawl(ctx context.Context, args []string) error {
+	fs := newFlagSet("crawl", "")
+	seedsFile := fs.String("seeds", "", "seeds file, overrides crawler.seeds_file")
+	fresh := fs.Bool("fresh", false, "start over: ignore a drain snapshot, or in cluster mode clear the shared frontier")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if *seedsFile != "" {
+		cfg.Crawler.SeedsFile = *seedsFile
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := storage.RunMigrations(db); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	resolver := dnscache.New(cfg.Politeness.DNSCacheTTL.Duration)
+
+	if *fresh {
+		if err := startFresh(ctx, cfg, db); err != nil {
+			return err
+		}
+	}
+
+	// a drained crawl left a snapshot to resume from
+	resume := false
+	if !cfg.Cluster.Enabled && cfg.Crawler.SnapshotFile != "" {
+		if _, err := os.Stat(cfg.Crawler.SnapshotFile); err == nil {
+			resume = true
+		}
+	}
+
+	f, err := newQueue(cfg, db, resolver, resume)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var state []byte
+	if local, ok := f.(*frontier.Frontier); ok && resume {
+		var n int
+		n, state, err = local.RestoreSnapshot(cfg.Crawler.SnapshotFile)
+		if err != nil {
+			return fmt.Errorf("couldn't restore frontier snapshot: %w", err)
+		}
+		slog.Info("frontier snapshot restored, skipping seeds", slog.String("path", cfg.Crawler.SnapshotFile), slog.Int("urls", n))
+	} else if err := frontier.LoadSeeds(cfg.Crawler.SeedsFile, f, process.NewNormalizer(cfg.Normalize)); err != nil {
+		return fmt.Errorf("couldn't load seeds: %w", err)
+	}
+
+	c, err := crawler.New(cfg, f, storage.New(db), crawler.WithResolver(resolver))
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		if err := c.RestoreState(state); err != nil {
+			return fmt.Errorf("couldn't restore crawl state: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go handleSignals(ctx, c, cancel)
+
+	if cfg.Admin.Addr != "" {
+		srv := &http.Server{Addr: cfg.Admin.Addr, Handler: admin.NewServer(c)}
+		go func() {
+			slog.Info("starting admin api", slog.String("addr", cfg.Admin.Addr))
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("admin api failed", slog.Any("err", err))
+			}
+		}()
+		defer srv.Close()
+	}
+
+	c.Start(ctx)
+
+	if local, ok := f.(*frontier.Frontier); ok && c.Draining() && cfg.Crawler.SnapshotFile != "" {
+		state, err := c.SaveState()
+		if err != nil {
+			return fmt.Errorf("couldn't save crawl state: %w", err)
+		}
+		n, err := local.Snapshot(cfg.Crawler.SnapshotFile, state)
+		if err != nil {
+			return fmt.Errorf("couldn't save frontier snapshot: %w", err)
+		}
+		slog.Info("frontier snapshot saved", slog.String("path", cfg.Crawler.SnapshotFile), slog.Int("urls", n))
+	}
+
+	slog.Info("shutdown complete")
+	return nil
+}
+
+// startFresh forgets what earlier crawls left behind: the shared frontier in
+// cluster mode, the drain snapshot otherwise.
+func startFresh(ctx context.Context, cfg *config.Config, db *sql.DB) error {
+	if cfg.Cluster.Enabled {
+		if err := cluster.Reset(ctx, db, cfg.Cluster.ClaimTimeout.Duration); err != nil {
+			return fmt.Errorf("couldn't reset the cluster frontier: %w", err)
+		}
+		slog.Info("cluster frontier cleared")
+		return nil
+	}
+
+	if cfg.Crawler.SnapshotFile == "" {
+		return nil
+	}
+	err := os.Remove(cfg.Crawler.SnapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't remove frontier snapshot: %w", err)
+	}
+	slog.Info("frontier snapshot discarded", slog.String("path", cfg.Crawler.SnapshotFile))
+	return nil
+}
+
+// handleSignals lets an operator steer the crawl: the pause signal (SIGUSR1)
+// toggles pausing and SIGTERM drains the crawl. A second SIGTERM stops it
+// without waiting for in-flight pages.
+func handleSignals(ctx context.Context, c *crawler.Crawler, cancel context.CancelFunc) {
+	sigs := []os.Signal{syscall.SIGTERM}
+	if pauseSignal != nil {
+		sigs = append(sigs, pauseSignal)
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-ch:
+			switch {
+			case sig == syscall.SIGTERM && c.Draining():
+				slog.Warn("second SIGTERM, stopping now")
+				cancel()
+			case sig == syscall.SIGTERM:
+				slog.Info("SIGTERM received, draining: finishing in-flight pages")
+				c.Drain()
+			case c.Paused():
+				slog.Info("resuming crawl")
+				c.Resume()
+			default:
+				slog.Info("pausing crawl, send the signal again to resume")
+				c.Pause()
+			}
+		}
+	}
+}
+
+// newQueue builds the shared database frontier in cluster mode and the
+// in-process one otherwise, keeping the disk seen-set when resuming.
+func newQueue(cfg *config.Config, db *sql.DB, resolver *dnscache.Resolver, resume bool) (frontier.Queue, error) {
+	if !cfg.Cluster.Enabled {
+		return frontier.NewFromConfig(cfg, resolver, resume)
+	}
+
+	scorer, err := frontier.NewScorer(cfg.Frontier)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frontier config: %w", err)
+	}
+
+	key, err := frontier.NewKeyFunc(cfg.Politeness.Group, resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	id := cfg.Cluster.InstanceID
+	if id == "" {
+		id = cluster.DefaultInstanceID()
+	}
+	slog.Info("joining crawl cluster", slog.String("instance", id))
+	return cluster.NewFrontier(db, id, cluster.Options{
+		Scorer:       scorer,
+		Key:          key,
+		Throttle:     frontier.NewThrottle(cfg.Politeness),
+		ClaimTimeout: cfg.Cluster.ClaimTimeout.Duration,
+	}), nil
+}
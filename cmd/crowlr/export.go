@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+type exportRecord struct {
+	URL          string            `json:"url"`
+	RawURL       string            `json:"raw_url"`
+	Referrer     string            `json:"referrer,omitempty"`
+	Timestamp    time.Time         `json:"timestamp"`
+	LastModified *time.Time        `json:"last_modified,omitempty"`
+	StatusCode   int               `json:"status_code"`
+	ContentType  string            `json:"content_type"`
+	Title        string            `json:"title"`
+	Content      string            `json:"content"`
+	MainContent  string            `json:"main_content,omitempty"`
+	HTML         string            `json:"html,omitempty"`
+	Outlinks     []string          `json:"outlinks,omitempty"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Keywords     []string          `json:"keywords,omitempty"`
+	Language     string            `json:"language,omitempty"`
+	Headings     []string          `json:"headings,omitempty"`
+	PublishedAt  *time.Time        `json:"published_at,omitempty"`
+	Metadata     *storage.Metadata `json:"metadata,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+}
+
+func newExportRecord(p storage.Page, withHTML bool) exportRecord {
+	r := exportRecord{
+		URL:          p.URL,
+		RawURL:       p.RawURL,
+		Referrer:     p.Referrer,
+		Timestamp:    p.Timestamp,
+		LastModified: p.LastModified,
+		StatusCode:   p.StatusCode,
+		ContentType:  p.ContentType,
+		Title:        p.Title,
+		Content:      p.Content,
+		MainContent:  p.MainContent,
+		Outlinks:     p.Outlinks,
+		Fields:       p.Fields,
+		Description:  p.Description,
+		Keywords:     p.Keywords,
+		Language:     p.Language,
+		Headings:     p.Headings,
+		PublishedAt:  p.PublishedAt,
+		Tags:         p.Tags,
+	}
+	if !p.Metadata.IsZero() {
+		r.Metadata = &p.Metadata
+	}
+	if withHTML {
+		r.HTML = p.HTML
+	}
+	return r
+}
+
+var csvHeader = []string{"url", "raw_url", "referrer", "timestamp", "last_modified", "published_at", "status_code", "content_type", "language", "title", "description", "content", "main_content", "fields", "tags"}
+
+func (r exportRecord) csvRow() []string {
+	lastModified := ""
+	if r.LastModified != nil {
+		lastModified = r.LastModified.Format(time.RFC3339)
+	}
+	publishedAt := ""
+	if r.PublishedAt != nil {
+		publishedAt = r.PublishedAt.Format(time.RFC3339)
+	}
+	fields := ""
+	if len(r.Fields) > 0 {
+		b, _ := json.Marshal(r.Fields)
+		fields = string(b)
+	}
+	return []string{
+		r.URL,
+		r.RawURL,
+		r.Referrer,
+		r.Timestamp.Format(time.RFC3339),
+		lastModified,
+		publishedAt,
+		strconv.Itoa(r.StatusCode),
+		r.ContentType,
+		r.Language,
+		r.Title,
+		r.Description,
+		r.Content,
+		r.MainContent,
+		fields,
+		strings.Join(r.Tags, ","),
+	}
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := newFlagSet("export", "")
+	format := fs.String("format", "jsonl", "output format: jsonl or csv")
+	out := fs.String("out", "-", "output file, - for stdout")
+	withHTML := fs.Bool("html", false, "include raw HTML (jsonl only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *format != "jsonl" && *format != "csv" {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count := 0
+	switch *format {
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		err = store.EachPage(ctx, func(p storage.Page) error {
+			count++
+			return enc.Encode(newExportRecord(p, *withHTML))
+		})
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		err = store.EachPage(ctx, func(p storage.Page) error {
+			count++
+			return cw.Write(newExportRecord(p, false).csvRow())
+		})
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d pages\n", count)
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/logger"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"crawl", "run the crawler against the configured seeds", runCrawl},
+	{"serve", "serve the search UI", runServe},
+	{"migrate", "apply, revert or inspect database migrations (up, down, status)", runMigrate},
+	{"seed", "manage the seeds file (add)", runSeed},
+	{"export", "export crawled pages as JSON lines or CSV", runExport},
+	{"search", "run a full-text query from the terminal", runSearch},
+	{"stats", "print storage statistics", runStats},
+	{"traps", "list URL patterns quarantined as crawler traps", runTraps},
+	{"block", "stop running crawls from fetching hosts", runBlock},
+}
+
+var errUsage = errors.New("usage")
+
+// configPath is shared by the global flag set and every subcommand flag set so
+// that --config may appear either before or after the command name.
+var configPath = defaultConfigPath()
+
+func defaultConfigPath() string {
+	if p := os.Getenv("CROWLR_CONFIG"); p != "" {
+		return p
+	}
+	return "config.toml"
+}
+
+func main() {
+	global := flag.NewFlagSet("crowlr", flag.ContinueOnError)
+	global.StringVar(&configPath, "config", configPath, "path to the TOML config file (env CROWLR_CONFIG)")
+	global.Usage = func() { usage(global) }
+
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+
+	args := global.Args()
+	if len(args) == 0 {
+		usage(global)
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "crowlr: unknown command %q\n\n", args[0])
+		usage(global)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGQUIT)
+	defer stop()
+
+	if err := cmd.run(ctx, args[1:]); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		slog.Error("fatal: "+cmd.name+" failed", slog.Any("err", err))
+		os.Exit(1)
+	}
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "usage: crowlr [--config path] <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(out, "\nglobal flags:\n")
+	fs.PrintDefaults()
+}
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("crowlr "+name, flag.ContinueOnError)
+	fs.StringVar(&configPath, "config", configPath, "path to the TOML config file (env CROWLR_CONFIG)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: crowlr %s [flags] %s\n\nflags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// loadConfig reads the config file and initializes logging. Commands whose
+// output goes to stdout log to stderr instead so the two don't interleave.
+func loadConfig(logOut io.Writer) (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config %s: %w", configPath, err)
+	}
+
+	logger.InitLogger(cfg, logOut)
+	return cfg, nil
+}
+
+// openDB opens the configured database. The dsn is checked here rather than
+// in Validate, since commands like seed add never touch the database.
+func openDB(cfg *config.Config) (*sql.DB, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("dsn is required (set it in the file or via CROWLR_DSN)")
+	}
+	return storage.OpenDB(cfg.DSN)
+}
+
+func openStore(cfg *config.Config) (storage.Storage, error) {
+	db, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return storage.New(db), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := newFlagSet("migrate", "up | down [steps] | status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch fs.Arg(0) {
+	case "up":
+		return storage.RunMigrations(db)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			steps, err = strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", fs.Arg(1))
+			}
+		}
+		return storage.RollbackMigrations(db, steps)
+	case "status":
+		version, dirty, err := storage.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d\ndirty:   %t\n", version, dirty)
+		return nil
+	default:
+		fs.Usage()
+		return errUsage
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+const (
+	ansiBold  = "\x1b[1m"
+	ansiReset = "\x1b[0m"
+)
+
+func runSearch(ctx context.Context, args []string) error {
+	fs := newFlagSet("search", "<query>")
+	limit := fs.Int("limit", 10, "maximum number of results")
+	plain := fs.Bool("plain", false, "disable highlighting")
+	language := fs.String("lang", "", "query language (ISO 639-1 code or text search config), detected from the query if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	resp, err := store.Search(ctx, query, *language, *limit)
+	if err != nil {
+		return err
+	}
+
+	searchedIn := "all languages"
+	if resp.Language != "" {
+		searchedIn = resp.Language
+	}
+	fmt.Printf("showing %d of %d results for %q (%s)\n\n", len(resp.Results), resp.TotalCount, query, searchedIn)
+	for i, r := range resp.Results {
+		title := r.Title
+		if title == "" {
+			title = r.URL
+		}
+		fmt.Printf("%d. %s\n   %s\n   %s\n", i+1, title, r.URL, terminalSnippet(r, *plain))
+		if r.ContentType != "" && r.ContentType != "text/html" {
+			fmt.Printf("   type: %s\n", r.ContentType)
+		}
+		if r.PublishedAt != nil {
+			fmt.Printf("   published: %s\n", r.PublishedAt.Format(time.DateOnly))
+		}
+		for _, name := range slices.Sorted(maps.Keys(r.Fields)) {
+			fmt.Printf("   %s: %s\n", name, r.Fields[name])
+		}
+		fmt.Printf("   rank %.4f\n\n", r.Rank)
+	}
+
+	return nil
+}
+
+// terminalSnippet turns the <mark> highlighting produced by the storage
+// backend into ANSI bold, or strips it when plain is set, and unescapes the
+// rest of the HTML snippet.
+func terminalSnippet(r storage.SearchResult, plain bool) string {
+	open, close := ansiBold, ansiReset
+	if plain {
+		open, close = "", ""
+	}
+	s := html.UnescapeString(strings.NewReplacer("<mark>", open, "</mark>", close).Replace(r.Snippet))
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	netUrl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/devraulu/crowlr/pkg/process"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+func runSeed(ctx context.Context, args []string) error {
+	fs := newFlagSet("seed", "add <url>...")
+	live := fs.Bool("live", false, "also queue the seeds in running crawls")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 || fs.Arg(0) != "add" {
+		fs.Usage()
+		return errUsage
+	}
+	// flags may also follow "add"
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	normalizer := process.NewNormalizer(cfg.Normalize)
+
+	urls := fs.Args()
+	for _, url := range urls {
+		normalized, err := normalizer.Normalize(url)
+		if err != nil {
+			return fmt.Errorf("invalid seed %q: %w", url, err)
+		}
+		if u, err := netUrl.Parse(normalized); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid seed %q: must be an absolute http(s) url", url)
+		}
+	}
+
+	if err := appendSeeds(cfg.Crawler.SeedsFile, urls); err != nil {
+		return err
+	}
+	for _, url := range urls {
+		slog.Info("seed added", slog.String("seed", url), slog.String("path", cfg.Crawler.SeedsFile))
+	}
+
+	if !*live {
+		return nil
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	for _, url := range urls {
+		if err := store.SaveCommand(ctx, storage.CommandSeed, url); err != nil {
+			return fmt.Errorf("couldn't send seed %q to running crawls: %w", url, err)
+		}
+	}
+
+	return nil
+}
+
+// appendSeeds adds urls to the seeds file at path in its format: a line
+// each in a text file, a [[seeds]] table each in a .toml file and an object
+// each in the array of a .json file.
+func appendSeeds(path string, urls []string) error {
+	type entry struct {
+		URL string `json:"url" toml:"url"`
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var seeds []json.RawMessage
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := json.Unmarshal(data, &seeds); err != nil {
+				return fmt.Errorf("invalid seeds file %s: %w", path, err)
+			}
+		}
+		for _, url := range urls {
+			b, err := json.Marshal(entry{URL: url})
+			if err != nil {
+				return err
+			}
+			seeds = append(seeds, b)
+		}
+		out, err := json.MarshalIndent(seeds, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append(out, '\n'), 0o644)
+
+	case ".toml":
+		entries := make([]entry, len(urls))
+		for i, url := range urls {
+			entries[i] = entry{URL: url}
+		}
+		out, err := toml.Marshal(struct {
+			Seeds []entry `toml:"seeds"`
+		}{entries})
+		if err != nil {
+			return err
+		}
+		return appendFile(path, append([]byte("\n"), out...))
+
+	default:
+		return appendFile(path, []byte(strings.Join(urls, "\n")+"\n"))
+	}
+}
+
+// appendFile appends data to path, first ending its last line if the file
+// doesn't end in a newline.
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, size-1); err != nil {
+			file.Close()
+			return err
+		}
+		if last[0] != '\n' {
+			data = append([]byte("\n"), data...)
+		}
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// pauseSignal is nil where SIGUSR1 doesn't exist; use the admin API instead.
+var pauseSignal os.Signal
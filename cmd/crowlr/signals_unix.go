@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// pauseSignal toggles pausing a running crawl.
+var pauseSignal os.Signal = syscall.SIGUSR1
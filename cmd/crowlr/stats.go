@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runStats(ctx context.Context, args []string) error {
+	fs := newFlagSet("stats", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	st, err := store.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("pages:         %d\n", st.Pages)
+	fmt.Printf("hosts:         %d\n", st.Hosts)
+	fmt.Printf("sitemaps:      %d\n", st.Sitemaps)
+	fmt.Printf("feeds:         %d\n", st.Feeds)
+	if st.FirstCrawled != nil {
+		fmt.Printf("first crawled: %s\n", st.FirstCrawled.Format(time.RFC3339))
+	}
+	if st.LastCrawled != nil {
+		fmt.Printf("last crawled:  %s\n", st.LastCrawled.Format(time.RFC3339))
+	}
+	if len(st.StatusCodes) > 0 {
+		fmt.Println("status codes:")
+		for _, sc := range st.StatusCodes {
+			fmt.Printf("  %3d  %d\n", sc.StatusCode, sc.Count)
+		}
+	}
+	if len(st.Cutoffs) > 0 {
+		fmt.Println("cut off hosts:")
+		for _, c := range st.Cutoffs {
+			fmt.Printf("  %s  %s (%d pages, %d bytes, %s)\n", c.Host, c.Reason, c.Pages, c.Bytes, c.CutAt.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+func runTraps(ctx context.Context, args []string) error {
+	fs := newFlagSet("traps", "")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	qs, err := store.Quarantines(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(qs) == 0 {
+		fmt.Println("no quarantined patterns")
+		return nil
+	}
+
+	for _, q := range qs {
+		fmt.Printf("%s%s\n", q.Host, q.Pattern)
+		fmt.Printf("  reason:  %s (%d urls accepted)\n", q.Reason, q.URLs)
+		fmt.Printf("  example: %s\n", q.Example)
+		fmt.Printf("  at:      %s\n", q.QuarantinedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+// Package admin serves a small HTTP API for steering a running crawl.
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/crawler"
+)
+
+type Server struct {
+	crawler *crawler.Crawler
+	mux     *http.ServeMux
+}
+
+// Stats is the body of GET /stats.
+type Stats struct {
+	StartTime      time.Time `json:"start_time"`
+	Elapsed        string    `json:"elapsed"`
+	PagesProcessed int       `json:"pages_processed"`
+	PagesErrored   int       `json:"pages_errored"`
+	PagesSkipped   int       `json:"pages_skipped"`
+	PagesPerSecond float64   `json:"pages_per_sec"`
+	Queued         int       `json:"queued"`
+	Paused         bool      `json:"paused"`
+	Draining       bool      `json:"draining"`
+	BlockedHosts   []string  `json:"blocked_hosts"`
+	StopReason     string    `json:"stop_reason,omitempty"`
+}
+
+func NewServer(c *crawler.Crawler) *Server {
+	s := &Server{
+		crawler: c,
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("GET /stats", s.handleStats)
+	s.mux.HandleFunc("POST /pause", s.handlePause)
+	s.mux.HandleFunc("POST /resume", s.handleResume)
+	s.mux.HandleFunc("POST /drain", s.handleDrain)
+	s.mux.HandleFunc("POST /seeds", s.handleSeed)
+	s.mux.HandleFunc("POST /blocks", s.handleBlock)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	queued, err := s.crawler.QueueLen()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	st := s.crawler.CurrentStats()
+	writeJSON(w, http.StatusOK, Stats{
+		StartTime:      st.StartTime,
+		Elapsed:        st.Elapsed().Round(time.Second).String(),
+		PagesProcessed: st.PagesProcessed,
+		PagesErrored:   st.PagesErrored,
+		PagesSkipped:   st.PagesSkipped,
+		PagesPerSecond: st.PagesPerSecond(),
+		Queued:         queued,
+		Paused:         s.crawler.Paused(),
+		Draining:       s.crawler.Draining(),
+		BlockedHosts:   s.crawler.BlockedHosts(),
+		StopReason:     st.StopReason,
+	})
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.crawler.Pause()
+	slog.Info("crawl paused", slog.String("via", "admin"))
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.crawler.Resume()
+	slog.Info("crawl resumed", slog.String("via", "admin"))
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	s.crawler.Drain()
+	slog.Info("crawl draining", slog.String("via", "admin"))
+	writeJSON(w, http.StatusAccepted, map[string]bool{"draining": true})
+}
+
+// handleSeed queues the url form value ahead of the crawl.
+func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
+	raw := r.FormValue("url")
+	if raw == "" {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+
+	normalized, added, err := s.crawler.AddSeed(r.Context(), raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	slog.Info("seed added", slog.String("url", normalized), slog.Bool("queued", added), slog.String("via", "admin"))
+	writeJSON(w, http.StatusOK, map[string]any{"url": normalized, "queued": added})
+}
+
+// handleBlock blocks the host form value and its subdomains.
+func (s *Server) handleBlock(w http.ResponseWriter, r *http.Request) {
+	host := r.FormValue("host")
+	if host == "" {
+		writeError(w, http.StatusBadRequest, "host is required")
+		return
+	}
+
+	s.crawler.BlockHost(host)
+	slog.Info("host blocked", slog.String("host", host), slog.String("via", "admin"))
+	writeJSON(w, http.StatusOK, map[string]any{"host": host, "blocked": true})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("admin response failed", slog.Any("err", err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
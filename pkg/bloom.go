@@ -0,0 +1,160 @@
+package frontier
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Each filter added to a BloomSeenSet holds twice as many URLs as the last
+// with a tighter error rate, which keeps the overall false positive rate
+// under the configured one.
+const (
+	bloomGrowth     = 2
+	bloomTightening = 0.5
+)
+
+// BloomSeenSet is a scalable Bloom filter. It uses a few bits per URL and
+// grows as needed, at the cost of rarely reporting a new URL as seen, which
+// then is never crawled.
+type BloomSeenSet struct {
+	mu       sync.Mutex
+	filters  []*bloomFilter
+	capacity int
+	rate     float64
+}
+
+// NewBloomSeenSet returns a filter sized for capacity URLs before it first
+// grows, with an overall false positive rate of at most rate.
+func NewBloomSeenSet(capacity int, rate float64) *BloomSeenSet {
+	s := &BloomSeenSet{
+		capacity: capacity,
+		rate:     rate * (1 - bloomTightening),
+	}
+	s.filters = append(s.filters, newBloomFilter(s.capacity, s.rate))
+	return s
+}
+
+func (s *BloomSeenSet) Add(url string) (bool, error) {
+	h1, h2 := bloomHash(url)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.filters {
+		if f.has(h1, h2) {
+			return false, nil
+		}
+	}
+
+	last := s.filters[len(s.filters)-1]
+	if last.count >= last.capacity {
+		n := len(s.filters)
+		capacity := last.capacity * bloomGrowth
+		rate := s.rate * math.Pow(bloomTightening, float64(n))
+		last = newBloomFilter(capacity, rate)
+		s.filters = append(s.filters, last)
+	}
+	last.add(h1, h2)
+	return true, nil
+}
+
+func (s *BloomSeenSet) Close() error {
+	return nil
+}
+
+// bloomState is the saved form of a BloomSeenSet.
+type bloomState struct {
+	Filters  []bloomFilterState
+	Capacity int
+	Rate     float64
+}
+
+type bloomFilterState struct {
+	Bits     []uint64
+	M        uint64
+	K        int
+	Count    int
+	Capacity int
+}
+
+func (s *BloomSeenSet) MarshalBinary() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := bloomState{Capacity: s.capacity, Rate: s.rate}
+	for _, f := range s.filters {
+		st.Filters = append(st.Filters, bloomFilterState{Bits: f.bits, M: f.m, K: f.k, Count: f.count, Capacity: f.capacity})
+	}
+	return gobEncode(st)
+}
+
+// UnmarshalBinary replaces the set's filters with saved ones.
+func (s *BloomSeenSet) UnmarshalBinary(data []byte) error {
+	var st bloomState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	if len(st.Filters) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.capacity, s.rate = st.Capacity, st.Rate
+	s.filters = s.filters[:0]
+	for _, f := range st.Filters {
+		s.filters = append(s.filters, &bloomFilter{bits: f.Bits, m: f.M, k: f.K, count: f.Count, capacity: f.Capacity})
+	}
+	return nil
+}
+
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64
+	k        int
+	count    int
+	capacity int
+}
+
+func newBloomFilter(capacity int, rate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(rate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	return &bloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        max(1, int(math.Ceil(math.Log2(1/rate)))),
+		capacity: capacity,
+	}
+}
+
+func (f *bloomFilter) has(h1, h2 uint64) bool {
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) add(h1, h2 uint64) {
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// bloomHash splits a 128-bit FNV-1a hash into the two hashes used for double
+// hashing.
+func bloomHash(s string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(s))
+	sum := h.Sum(nil)
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
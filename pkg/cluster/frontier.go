@@ -0,0 +1,564 @@
+// Package cluster lets several crawler processes share one frontier through
+// Postgres.
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+)
+
+const (
+	// queryTimeout bounds every frontier query.
+	queryTimeout = 10 * time.Second
+	// maxWait is the longest Pop asks the crawler to wait, so URLs pushed by
+	// other instances are picked up promptly.
+	maxWait = time.Second
+	minWait = 50 * time.Millisecond
+)
+
+// frontScore ranks URLs pushed with PushFront above any scored URL.
+const frontScore = math.MaxFloat64
+
+// Frontier is a frontier.Queue stored in the frontier_urls and
+// frontier_hosts tables. Instances claim URLs with FOR UPDATE SKIP LOCKED on
+// the host row, which also holds the host's next visit time, so the
+// politeness delay applies across the whole cluster. Host rows are keyed by
+// politeness group, the hostname unless grouped by domain or address, and
+// each URL keeps the group it was queued under. The URL table doubles as the
+// seen-set. URLs claimed by an instance that dies are queued again
+// after the claim timeout.
+var _ frontier.Queue = (*Frontier)(nil)
+
+type Frontier struct {
+	db       *sql.DB
+	instance string
+	opts     Options
+
+	mu          sync.Mutex
+	lastReclaim time.Time
+	// defaultDelay is the delay last passed to Pop, where throttling starts
+	defaultDelay time.Duration
+}
+
+// Options configure a cluster Frontier. Unset fields take the in-process
+// frontier's defaults.
+type Options struct {
+	Scorer frontier.Scorer
+	Key    frontier.KeyFunc
+	// Throttle adapts each host's delay, shared by the whole cluster
+	Throttle *frontier.Throttle
+	// ClaimTimeout is how long a claim may stay unfinished before the URL
+	// is handed to another instance.
+	ClaimTimeout time.Duration
+}
+
+func NewFrontier(db *sql.DB, instance string, opts Options) *Frontier {
+	if opts.Scorer == nil {
+		opts.Scorer = frontier.DepthScorer{}
+	}
+	if opts.Key == nil {
+		opts.Key = frontier.HostKey
+	}
+	if opts.ClaimTimeout <= 0 {
+		opts.ClaimTimeout = 10 * time.Minute
+	}
+	return &Frontier{
+		db:       db,
+		instance: instance,
+		opts:     opts,
+	}
+}
+
+// Reset empties the shared frontier, and with it the seen-set, so the next
+// crawl starts from its seeds again. It fails while URLs are claimed by
+// instances that may still be running, i.e. claims younger than
+// claimTimeout.
+func Reset(ctx context.Context, db *sql.DB, claimTimeout time.Duration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// keeps instances from claiming or pushing until the tables are empty
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE frontier_urls, frontier_hosts IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	var claimed int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM frontier_urls
+		WHERE state = 'claimed' AND claimed_at >= now() - make_interval(secs => $1)`,
+		claimTimeout.Seconds(),
+	).Scan(&claimed)
+	if err != nil {
+		return err
+	}
+	if claimed > 0 {
+		return fmt.Errorf("%d urls are claimed by running instances, stop them first", claimed)
+	}
+
+	if _, err := tx.ExecContext(ctx, `TRUNCATE frontier_urls, frontier_hosts RESTART IDENTITY`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DefaultInstanceID names an instance after its host and process id.
+func DefaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "crowlr"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func (f *Frontier) Push(c frontier.Candidate) bool {
+	return f.push(c, f.opts.Scorer.Score(c))
+}
+
+func (f *Frontier) PushFront(c frontier.Candidate) bool {
+	return f.push(c, frontScore)
+}
+
+func (f *Frontier) push(c frontier.Candidate, score float64) bool {
+	// float8 parameters can't carry NaN or infinities through lib/pq
+	if math.IsNaN(score) {
+		score = 0
+	}
+	score = min(max(score, -frontScore), frontScore)
+
+	host := c.Group
+	if host == "" {
+		group, err := f.opts.Key.Group(c.Normalized)
+		if err != nil {
+			slog.Error("frontier bad url", slog.String("url", c.Normalized), slog.Any("err", err))
+			return false
+		}
+		host = group
+	}
+
+	var seed []byte
+	var err error
+	var seedDelay sql.NullFloat64
+	if c.Seed != nil {
+		if seed, err = json.Marshal(c.Seed); err != nil {
+			slog.Error("frontier push failed", slog.String("url", c.Normalized), slog.Any("err", err))
+			return false
+		}
+		if c.Seed.Delay > 0 {
+			seedDelay = sql.NullFloat64{Float64: c.Seed.Delay.Seconds(), Valid: true}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	// a seed delay becomes the host's delay and the floor of its throttled
+	// delay, unless it already has one
+	err = f.db.QueryRowContext(ctx, `
+		WITH inserted AS (
+			INSERT INTO frontier_urls (url, original_url, referrer, host, depth, priority, score, seed)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (url) DO NOTHING
+			RETURNING host
+		)
+		INSERT INTO frontier_hosts (host, queued, delay, min_delay)
+		SELECT host, 1, $9, $9 FROM inserted
+		ON CONFLICT (host) DO UPDATE
+		SET queued = frontier_hosts.queued + 1,
+			delay = COALESCE(frontier_hosts.delay, EXCLUDED.delay),
+			min_delay = COALESCE(frontier_hosts.min_delay, EXCLUDED.min_delay)
+		RETURNING host`,
+		c.Normalized, c.Original, c.Referrer, host, c.Depth, c.Priority, score, seed, seedDelay,
+	).Scan(&host)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Info("frontier duplicate, skipping", slog.String("url", c.Normalized), slog.String("original_url", c.Original))
+		return false
+	}
+	if err != nil {
+		slog.Error("frontier push failed", slog.String("url", c.Normalized), slog.Any("err", err))
+		return false
+	}
+
+	slog.Debug("frontier push", slog.String("host", host), slog.String("url", c.Normalized), slog.Float64("score", score))
+	return true
+}
+
+// Pop claims the best URL of the host whose next visit is due soonest and
+// that no other instance is claiming from right now.
+func (f *Frontier) Pop(defaultDelay time.Duration) (*frontier.Candidate, time.Duration) {
+	f.mu.Lock()
+	f.defaultDelay = defaultDelay
+	f.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	f.reclaimExpired(ctx)
+
+	c, err := f.claim(ctx, defaultDelay)
+	if err != nil {
+		slog.Error("frontier claim failed", slog.Any("err", err))
+		return nil, maxWait
+	}
+	if c != nil {
+		return c, 0
+	}
+
+	return nil, f.nextWait(ctx)
+}
+
+func (f *Frontier) claim(ctx context.Context, delay time.Duration) (*frontier.Candidate, error) {
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var host string
+	err = tx.QueryRowContext(ctx, `
+		SELECT host
+		FROM frontier_hosts
+		WHERE queued > 0 AND next_visit <= now()
+		ORDER BY next_visit
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`,
+	).Scan(&host)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var id int64
+	var c frontier.Candidate
+	var seed []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, url, COALESCE(original_url, ''), COALESCE(referrer, ''), depth, priority, seed
+		FROM frontier_urls
+		WHERE host = $1 AND state = 'queued'
+		ORDER BY score DESC, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`,
+		host,
+	).Scan(&id, &c.Normalized, &c.Original, &c.Referrer, &c.Depth, &c.Priority, &seed)
+	c.Group = host
+	if errors.Is(err, sql.ErrNoRows) {
+		// the counter drifted; recount so the host stops being picked
+		_, err = tx.ExecContext(ctx, `
+			UPDATE frontier_hosts
+			SET queued = (SELECT COUNT(*) FROM frontier_urls WHERE host = $1 AND state = 'queued')
+			WHERE host = $1`,
+			host,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if seed != nil {
+		c.Seed = new(frontier.SeedOptions)
+		if err := json.Unmarshal(seed, c.Seed); err != nil {
+			slog.Warn("frontier seed options unreadable, ignoring them", slog.String("url", c.Normalized), slog.Any("err", err))
+			c.Seed = nil
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE frontier_urls
+		SET state = 'claimed', claimed_by = $2, claimed_at = now()
+		WHERE id = $1`,
+		id, f.instance,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE frontier_hosts
+		SET queued = queued - 1, next_visit = now() + make_interval(secs => COALESCE(delay, $2))
+		WHERE host = $1`,
+		host, delay.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("next candidate", slog.String("host", host), slog.String("url", c.Normalized), slog.String("instance", f.instance))
+	return &c, nil
+}
+
+// nextWait returns how long until the next host becomes ready, capped so
+// that new work from other instances is noticed.
+func (f *Frontier) nextWait(ctx context.Context) time.Duration {
+	var secs sql.NullFloat64
+	err := f.db.QueryRowContext(ctx, `
+		SELECT EXTRACT(EPOCH FROM MIN(next_visit) - now())
+		FROM frontier_hosts
+		WHERE queued > 0`,
+	).Scan(&secs)
+	if err != nil || !secs.Valid {
+		return maxWait
+	}
+
+	wait := time.Duration(secs.Float64 * float64(time.Second))
+	return min(max(wait, minWait), maxWait)
+}
+
+// Reserve takes the next visit of rawURL's host row when it is due, across
+// the whole cluster, creating the row if the host has none yet.
+func (f *Frontier) Reserve(rawURL string, defaultDelay time.Duration) (time.Duration, error) {
+	host, err := f.opts.Key.Group(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO frontier_hosts (host) VALUES ($1)
+		ON CONFLICT (host) DO NOTHING`,
+		host,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var secs float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXTRACT(EPOCH FROM next_visit - now())
+		FROM frontier_hosts
+		WHERE host = $1
+		FOR UPDATE`,
+		host,
+	).Scan(&secs)
+	if err != nil {
+		return 0, err
+	}
+	if secs > 0 {
+		return seconds(secs), nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE frontier_hosts
+		SET next_visit = now() + make_interval(secs => COALESCE(delay, $2))
+		WHERE host = $1`,
+		host, defaultDelay.Seconds(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return 0, tx.Commit()
+}
+
+// Done marks a URL this instance claimed as crawled. It stays in the table
+// so it is not queued again. A claim that expired and was taken by another
+// instance is left to that instance.
+func (f *Frontier) Done(u string) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	_, err := f.db.ExecContext(ctx, `
+		UPDATE frontier_urls
+		SET state = 'done'
+		WHERE url = $1 AND state = 'claimed' AND claimed_by = $2`,
+		u, f.instance,
+	)
+	if err != nil {
+		slog.Error("frontier done failed", slog.String("url", u), slog.Any("err", err))
+	}
+}
+
+// Requeue releases this instance's claim on c so any instance may fetch it.
+func (f *Frontier) Requeue(c frontier.Candidate) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if _, err := f.requeue(ctx, `url = $1 AND claimed_by = $2`, c.Normalized, f.instance); err != nil {
+		slog.Error("frontier requeue failed", slog.String("url", c.Normalized), slog.Any("err", err))
+	}
+}
+
+// Report adapts the shared delay of the host url was queued under when
+// throttling is enabled.
+func (f *Frontier) Report(u string, latency time.Duration, statusCode int) {
+	if f.opts.Throttle == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := f.report(ctx, u, latency, statusCode); err != nil {
+		slog.Error("frontier report failed", slog.String("url", u), slog.Any("err", err))
+	}
+}
+
+func (f *Frontier) report(ctx context.Context, u string, latency time.Duration, statusCode int) error {
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var host string
+	var delay, minDelay sql.NullFloat64
+	var latencySecs float64
+	var st frontier.HostStats
+	err = tx.QueryRowContext(ctx, `
+		SELECT h.host, h.delay, h.min_delay, h.latency, h.error_rate, h.samples
+		FROM frontier_hosts h
+		JOIN frontier_urls u ON u.host = h.host
+		WHERE u.url = $1
+		FOR UPDATE OF h`,
+		u,
+	).Scan(&host, &delay, &minDelay, &latencySecs, &st.ErrorRate, &st.Samples)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	st.Delay = seconds(delay.Float64)
+	st.Latency = seconds(latencySecs)
+
+	f.mu.Lock()
+	defaultDelay := f.defaultDelay
+	f.mu.Unlock()
+	if minDelay.Valid {
+		// a seed delay, which the throttle may raise but not lower
+		defaultDelay = seconds(minDelay.Float64)
+	}
+
+	st = f.opts.Throttle.Update(st, defaultDelay, latency, statusCode)
+	if minDelay.Valid {
+		st.Delay = max(st.Delay, defaultDelay)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE frontier_hosts
+		SET delay = $2, latency = $3, error_rate = $4, samples = $5,
+			next_visit = GREATEST(next_visit, now() + make_interval(secs => $2))
+		WHERE host = $1`,
+		host, st.Delay.Seconds(), st.Latency.Seconds(), st.ErrorRate, st.Samples,
+	)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("frontier throttle", slog.String("host", host), slog.Int("status", statusCode), slog.Duration("latency", st.Latency),
+		slog.Float64("error_rate", st.ErrorRate), slog.Duration("delay", st.Delay))
+	return tx.Commit()
+}
+
+// Len returns how many URLs are queued or claimed across the cluster, so an
+// instance keeps running while others may still discover links. Queued URLs
+// are counted per host and claimed ones on their partial index, so neither
+// scans the whole URL table.
+func (f *Frontier) Len() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	var n int
+	err := f.db.QueryRowContext(ctx, `
+		SELECT (SELECT COALESCE(SUM(queued), 0) FROM frontier_hosts WHERE queued > 0)
+			+ (SELECT COUNT(*) FROM frontier_urls WHERE state = 'claimed')`,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't count frontier urls: %w", err)
+	}
+	return n, nil
+}
+
+// Close hands this instance's unfinished claims back to the cluster.
+func (f *Frontier) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	n, err := f.requeue(ctx, `claimed_by = $1`, f.instance)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		slog.Info("frontier released claims", slog.String("instance", f.instance), slog.Int64("urls", n))
+	}
+	return nil
+}
+
+// reclaimExpired requeues URLs whose claim is older than the claim timeout,
+// left behind by instances that stopped without closing. It runs at most
+// twice per timeout.
+func (f *Frontier) reclaimExpired(ctx context.Context) {
+	f.mu.Lock()
+	if time.Since(f.lastReclaim) < f.opts.ClaimTimeout/2 {
+		f.mu.Unlock()
+		return
+	}
+	f.lastReclaim = time.Now()
+	f.mu.Unlock()
+
+	n, err := f.requeue(ctx, `claimed_at < now() - make_interval(secs => $1)`, f.opts.ClaimTimeout.Seconds())
+	if err != nil {
+		slog.Error("frontier reclaim failed", slog.Any("err", err))
+		return
+	}
+	if n > 0 {
+		slog.Warn("frontier requeued expired claims", slog.Int64("urls", n))
+	}
+}
+
+// requeue puts the claimed URLs matching cond back in the queue and returns
+// how many there were.
+func (f *Frontier) requeue(ctx context.Context, cond string, args ...any) (int64, error) {
+	var n sql.NullInt64
+	err := f.db.QueryRowContext(ctx, `
+		WITH released AS (
+			UPDATE frontier_urls
+			SET state = 'queued', claimed_by = NULL, claimed_at = NULL
+			WHERE state = 'claimed' AND `+cond+`
+			RETURNING host
+		), counts AS (
+			SELECT host, COUNT(*) AS n FROM released GROUP BY host
+		), updated AS (
+			UPDATE frontier_hosts h
+			SET queued = h.queued + counts.n
+			FROM counts
+			WHERE h.host = counts.host
+		)
+		SELECT SUM(n) FROM counts`,
+		args...,
+	).Scan(&n)
+	return n.Int64, err
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
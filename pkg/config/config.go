@@ -1,7 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"net"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/pelletier/go-toml/v2"
@@ -9,21 +17,178 @@ import (
 
 type Config struct {
 	DSN        string           `toml:"dsn"`
+	Storage    StorageConfig    `toml:"storage"`
 	Crawler    CrawlerConfig    `toml:"crawler"`
 	Politeness PolitenessConfig `toml:"politeness"`
+	Frontier   FrontierConfig   `toml:"frontier"`
+	Budget     BudgetConfig     `toml:"budget"`
+	Traps      TrapsConfig      `toml:"traps"`
+	Normalize  NormalizeConfig  `toml:"normalize"`
+	Processing ProcessingConfig `toml:"processing"`
+	Extract    []ExtractRule    `toml:"extract"`
+	Feeds      FeedsConfig      `toml:"feeds"`
+	Cluster    ClusterConfig    `toml:"cluster"`
+	Admin      AdminConfig      `toml:"admin"`
 	Logging    LoggingConfig    `toml:"logging"`
 }
 
 type CrawlerConfig struct {
-	UserAgent  string `toml:"user_agent"`
-	SeedsFile  string `toml:"seeds_file"`
-	CrawlLimit int    `toml:"crawl_limit"`
-	Workers    int    `toml:"workers"`
+	UserAgent    string `toml:"user_agent"`
+	SeedsFile    string `toml:"seeds_file"`
+	CrawlLimit   int    `toml:"crawl_limit"`
+	Workers      int    `toml:"workers"`
+	MaxBodyBytes int64  `toml:"max_body_bytes"`
+	// SnapshotFile is where a drained crawl saves its frontier and progress
+	// and the next crawl resumes from, instead of loading the seeds. Empty
+	// disables snapshots.
+	SnapshotFile string `toml:"snapshot_file"`
+	// CommandPollInterval is how often crawl_commands is checked for seeds
+	// and host blocks sent to the running crawl. Zero disables it.
+	CommandPollInterval Duration `toml:"command_poll_interval"`
 }
 
+// PolitenessConfig sets the delay between requests to one politeness group.
+// Group is "host" for each hostname, "domain" for each registrable domain or
+// "ip" for each resolved server address. With Adaptive set, each group's
+// delay starts at Delay and follows its response times and errors within
+// MinDelay and MaxDelay.
 type PolitenessConfig struct {
-	Delay         string `toml:"delay"`
-	RobotsTimeout string `toml:"robots_timeout"`
+	Delay         Duration `toml:"delay"`
+	RobotsTimeout Duration `toml:"robots_timeout"`
+	Group         string   `toml:"group"`
+	DNSCacheTTL   Duration `toml:"dns_cache_ttl"`
+	Adaptive      bool     `toml:"adaptive"`
+	MinDelay      Duration `toml:"min_delay"`
+	MaxDelay      Duration `toml:"max_delay"`
+}
+
+// BudgetConfig limits what a crawl may spend, per host and in total. A host
+// that uses up its budget is cut off; running out of total bytes or time
+// ends the crawl. Zero means unlimited.
+type BudgetConfig struct {
+	MaxPagesPerHost int      `toml:"max_pages_per_host"`
+	MaxBytesPerHost int64    `toml:"max_bytes_per_host"`
+	MaxTotalBytes   int64    `toml:"max_total_bytes"`
+	MaxDuration     Duration `toml:"max_duration"`
+}
+
+// NormalizeConfig controls how URLs are normalized before they are queued,
+// so that variants of one page are only crawled once. Parameter names are
+// matched case-insensitively and may end in * to match a prefix.
+type NormalizeConfig struct {
+	// StripParams are removed from the query and from ;name=value path
+	// parameters, e.g. tracking parameters and session IDs.
+	StripParams []string `toml:"strip_params"`
+	// RemoveWWW drops a leading www. from the host.
+	RemoveWWW bool `toml:"remove_www"`
+	// IndexFiles are removed from the end of the path, so /docs/index.html
+	// becomes /docs/.
+	IndexFiles []string `toml:"index_files"`
+	// IDN converts internationalized host names to punycode.
+	IDN   bool                `toml:"idn"`
+	Hosts []HostNormalizeRule `toml:"hosts"`
+}
+
+// HostNormalizeRule adds rules for a host and its subdomains. When several
+// rules match, the one with the longest host wins.
+type HostNormalizeRule struct {
+	Host        string   `toml:"host"`
+	StripParams []string `toml:"strip_params"`
+	// KeepParams, when set, drops every query parameter not listed.
+	KeepParams []string `toml:"keep_params"`
+	// RemoveWWW overrides the global setting when set.
+	RemoveWWW     *bool `toml:"remove_www"`
+	LowercasePath bool  `toml:"lowercase_path"`
+}
+
+// TrapsConfig sets the limits past which a discovered URL is treated as a
+// crawler trap. Zero disables a check. Ordinary sections such as /post/N
+// share one pattern, so MaxURLsPerPattern must stay above the largest one
+// worth crawling.
+type TrapsConfig struct {
+	Enabled           bool `toml:"enabled"`
+	MaxURLLength      int  `toml:"max_url_length"`
+	MaxQueryParams    int  `toml:"max_query_params"`
+	MaxPathDepth      int  `toml:"max_path_depth"`
+	MaxSegmentRepeats int  `toml:"max_segment_repeats"`
+	MaxURLsPerPattern int  `toml:"max_urls_per_pattern"`
+}
+
+// FrontierConfig controls the order in which each host's URLs are crawled.
+// Scoring maps scorer names (depth, inlinks, priority, length, keywords) to
+// weights; left empty, shallow URLs are crawled first.
+type FrontierConfig struct {
+	Scoring  map[string]float64 `toml:"scoring"`
+	Keywords []string           `toml:"keywords"`
+	Seen     SeenConfig         `toml:"seen"`
+	Queue    QueueConfig        `toml:"queue"`
+}
+
+// QueueConfig bounds how many URLs of one host are held in memory. The rest
+// are spilled to segment files of SegmentSize URLs under SpillDir, or the
+// system temp directory when it is empty. A MemoryLimit of 0 never spills.
+type QueueConfig struct {
+	MemoryLimit int    `toml:"memory_limit"`
+	SegmentSize int    `toml:"segment_size"`
+	SpillDir    string `toml:"spill_dir"`
+}
+
+// SeenConfig chooses how the frontier remembers discovered URLs: "memory"
+// keeps them exactly, "bloom" in a fixed-error Bloom filter that grows past
+// Capacity, and "disk" in a key-value file at Path.
+type SeenConfig struct {
+	Type              string  `toml:"type"`
+	Capacity          int     `toml:"capacity"`
+	FalsePositiveRate float64 `toml:"false_positive_rate"`
+	Path              string  `toml:"path"`
+}
+
+type ProcessingConfig struct {
+	// ContentTypes lists the MIME types that are fetched and indexed, in
+	// order of preference. Responses of any other type are skipped.
+	ContentTypes []string `toml:"content_types"`
+	// Processors are run in order on every fetched page.
+	Processors []string `toml:"processors"`
+}
+
+// ExtractRule maps pages whose URL matches the URL regexp to named fields,
+// each selected with a CSS selector or an XPath expression. A CSS selector
+// may end in ::attr(name) to take an attribute instead of the text.
+type ExtractRule struct {
+	Name  string            `toml:"name"`
+	URL   string            `toml:"url"`
+	CSS   map[string]string `toml:"css"`
+	XPath map[string]string `toml:"xpath"`
+}
+
+// StorageConfig controls how crawled pages are written. With a positive
+// BatchSize pages are queued and written in batches of up to BatchSize, at
+// least every FlushInterval; zero writes each page as it is crawled.
+type StorageConfig struct {
+	BatchSize     int      `toml:"batch_size"`
+	FlushInterval Duration `toml:"flush_interval"`
+}
+
+// AdminConfig enables the HTTP control API of a running crawl. Empty Addr
+// disables it.
+type AdminConfig struct {
+	Addr string `toml:"addr"`
+}
+
+// FeedsConfig controls polling of the RSS and Atom feeds discovered while
+// crawling. With polling enabled the crawl keeps running until interrupted.
+type FeedsConfig struct {
+	Enabled      bool     `toml:"enabled"`
+	PollInterval Duration `toml:"poll_interval"`
+}
+
+// ClusterConfig lets several crawl processes share one frontier in the
+// database. InstanceID defaults to the hostname and process id; URLs claimed
+// by an instance are handed to others if not finished within ClaimTimeout.
+type ClusterConfig struct {
+	Enabled      bool     `toml:"enabled"`
+	InstanceID   string   `toml:"instance_id"`
+	ClaimTimeout Duration `toml:"claim_timeout"`
 }
 
 type LoggingConfig struct {
@@ -31,30 +196,348 @@ type LoggingConfig struct {
 	Format string `toml:"format"`
 }
 
+// Duration is a time.Duration that is written as a Go duration string
+// ("1s", "250ms") in TOML and environment variables.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Default returns a config with every optional field set to its default.
+func Default() *Config {
+	return &Config{
+		Storage: StorageConfig{
+			BatchSize:     200,
+			FlushInterval: Duration{2 * time.Second},
+		},
+		Crawler: CrawlerConfig{
+			SeedsFile:           "seeds.txt",
+			CrawlLimit:          1000,
+			Workers:             8,
+			MaxBodyBytes:        10 << 20,
+			SnapshotFile:        "frontier.snapshot",
+			CommandPollInterval: Duration{10 * time.Second},
+		},
+		Politeness: PolitenessConfig{
+			Delay:         Duration{time.Second},
+			RobotsTimeout: Duration{10 * time.Second},
+			Group:         "host",
+			DNSCacheTTL:   Duration{5 * time.Minute},
+			MinDelay:      Duration{250 * time.Millisecond},
+			MaxDelay:      Duration{time.Minute},
+		},
+		Traps: TrapsConfig{
+			Enabled:           true,
+			MaxURLLength:      512,
+			MaxQueryParams:    8,
+			MaxPathDepth:      16,
+			MaxSegmentRepeats: 3,
+			MaxURLsPerPattern: 100_000,
+		},
+		Normalize: NormalizeConfig{
+			StripParams: []string{
+				"utm_*", "fbclid", "gclid", "dclid", "msclkid", "yclid", "_ga", "_gl",
+				"mc_cid", "mc_eid", "igshid", "phpsessid", "jsessionid", "sessionid", "aspsessionid*",
+			},
+			IndexFiles: []string{"index.html", "index.htm", "index.php"},
+			IDN:        true,
+		},
+		Frontier: FrontierConfig{
+			Seen: SeenConfig{
+				Type:              "memory",
+				Capacity:          1_000_000,
+				FalsePositiveRate: 0.001,
+				Path:              "seen.db",
+			},
+			Queue: QueueConfig{
+				MemoryLimit: 100_000,
+				SegmentSize: 10_000,
+			},
+		},
+		Processing: ProcessingConfig{
+			ContentTypes: []string{
+				"text/html",
+				"application/xhtml+xml",
+				"text/plain",
+				"application/pdf",
+				"application/rss+xml",
+				"application/atom+xml",
+				"application/xml",
+				"text/xml",
+			},
+			Processors: []string{"links", "title", "metadata", "text", "maincontent", "language", "fields"},
+		},
+		Feeds: FeedsConfig{
+			PollInterval: Duration{15 * time.Minute},
+		},
+		Cluster: ClusterConfig{
+			ClaimTimeout: Duration{10 * time.Minute},
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// Load reads the TOML file at path on top of the defaults, applies CROWLR_*
+// environment overrides and validates the result.
 func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg Config
-	cfg.Crawler.SeedsFile = "seeds.txt"
-	cfg.Politeness.Delay = "1s"
-	cfg.Logging.Format = "text"
-	cfg.Logging.Level = "info"
+	cfg := Default()
 
-	err = toml.Unmarshal(data, &cfg)
+	err = toml.Unmarshal(data, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return &cfg, nil
+	if err := ApplyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
 
-func (c *PolitenessConfig) GetDelay() time.Duration {
-	d, err := time.ParseDuration(c.Delay)
-	if err != nil {
-		return 1 * time.Second // Fallback
+// Validate reports every invalid field at once, joined into a single error.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Crawler.UserAgent == "" {
+		fail("crawler.user_agent", "is required")
+	}
+	if c.Crawler.SeedsFile == "" {
+		fail("crawler.seeds_file", "is required")
+	}
+	if c.Crawler.CrawlLimit < 0 {
+		fail("crawler.crawl_limit", "must be 0 (unlimited) or positive, got %d", c.Crawler.CrawlLimit)
+	}
+	if c.Crawler.Workers < 1 {
+		fail("crawler.workers", "must be at least 1, got %d", c.Crawler.Workers)
+	}
+	if c.Crawler.MaxBodyBytes < 1 {
+		fail("crawler.max_body_bytes", "must be positive, got %d", c.Crawler.MaxBodyBytes)
+	}
+	if c.Storage.BatchSize < 0 {
+		fail("storage.batch_size", "must be 0 (no batching) or positive, got %d", c.Storage.BatchSize)
 	}
-	return d
+	if c.Storage.BatchSize > 0 && c.Storage.FlushInterval.Duration <= 0 {
+		fail("storage.flush_interval", "must be positive, got %s", c.Storage.FlushInterval)
+	}
+	if c.Crawler.CommandPollInterval.Duration < 0 {
+		fail("crawler.command_poll_interval", "must be 0 (disabled) or positive, got %s", c.Crawler.CommandPollInterval)
+	}
+
+	if c.Politeness.Delay.Duration < 0 {
+		fail("politeness.delay", "must not be negative, got %s", c.Politeness.Delay)
+	}
+	if c.Politeness.RobotsTimeout.Duration <= 0 {
+		fail("politeness.robots_timeout", "must be positive, got %s", c.Politeness.RobotsTimeout)
+	}
+	switch c.Politeness.Group {
+	case "host", "domain", "ip":
+	default:
+		fail("politeness.group", "must be host, domain or ip, got %q", c.Politeness.Group)
+	}
+	if c.Politeness.DNSCacheTTL.Duration <= 0 {
+		fail("politeness.dns_cache_ttl", "must be positive, got %s", c.Politeness.DNSCacheTTL)
+	}
+	if c.Politeness.Adaptive {
+		if c.Politeness.MinDelay.Duration < 0 {
+			fail("politeness.min_delay", "must not be negative, got %s", c.Politeness.MinDelay)
+		}
+		if c.Politeness.MaxDelay.Duration < c.Politeness.MinDelay.Duration {
+			fail("politeness.max_delay", "must not be less than min_delay (%s), got %s", c.Politeness.MinDelay, c.Politeness.MaxDelay)
+		}
+	}
+
+	if c.Budget.MaxPagesPerHost < 0 {
+		fail("budget.max_pages_per_host", "must be 0 (unlimited) or positive, got %d", c.Budget.MaxPagesPerHost)
+	}
+	if c.Budget.MaxBytesPerHost < 0 {
+		fail("budget.max_bytes_per_host", "must be 0 (unlimited) or positive, got %d", c.Budget.MaxBytesPerHost)
+	}
+	if c.Budget.MaxTotalBytes < 0 {
+		fail("budget.max_total_bytes", "must be 0 (unlimited) or positive, got %d", c.Budget.MaxTotalBytes)
+	}
+	if c.Budget.MaxDuration.Duration < 0 {
+		fail("budget.max_duration", "must be 0 (unlimited) or positive, got %s", c.Budget.MaxDuration)
+	}
+
+	for field, v := range map[string]int{
+		"traps.max_url_length":       c.Traps.MaxURLLength,
+		"traps.max_query_params":     c.Traps.MaxQueryParams,
+		"traps.max_path_depth":       c.Traps.MaxPathDepth,
+		"traps.max_segment_repeats":  c.Traps.MaxSegmentRepeats,
+		"traps.max_urls_per_pattern": c.Traps.MaxURLsPerPattern,
+	} {
+		if v < 0 {
+			fail(field, "must be 0 (no limit) or positive, got %d", v)
+		}
+	}
+
+	for i, p := range c.Normalize.StripParams {
+		if !validParamPattern(p) {
+			fail(fmt.Sprintf("normalize.strip_params[%d]", i), "%q must be a parameter name, optionally ending in *", p)
+		}
+	}
+	for i, f := range c.Normalize.IndexFiles {
+		if f == "" || strings.Contains(f, "/") {
+			fail(fmt.Sprintf("normalize.index_files[%d]", i), "%q must be a file name", f)
+		}
+	}
+	for i, rule := range c.Normalize.Hosts {
+		field := fmt.Sprintf("normalize.hosts[%d]", i)
+		if rule.Host == "" || strings.ContainsAny(rule.Host, "/:*") {
+			fail(field+".host", "%q must be a bare host name", rule.Host)
+		}
+		for _, p := range append(append([]string{}, rule.StripParams...), rule.KeepParams...) {
+			if !validParamPattern(p) {
+				fail(field, "%q must be a parameter name, optionally ending in *", p)
+			}
+		}
+	}
+
+	for name, weight := range c.Frontier.Scoring {
+		if math.IsNaN(weight) || math.IsInf(weight, 0) {
+			fail("frontier.scoring", "weight of %q must be a finite number", name)
+		}
+	}
+
+	switch c.Frontier.Seen.Type {
+	case "memory", "disk":
+	case "bloom":
+		if c.Frontier.Seen.Capacity < 1 {
+			fail("frontier.seen.capacity", "must be positive, got %d", c.Frontier.Seen.Capacity)
+		}
+		if rate := c.Frontier.Seen.FalsePositiveRate; rate <= 0 || rate >= 1 {
+			fail("frontier.seen.false_positive_rate", "must be between 0 and 1, got %g", rate)
+		}
+	default:
+		fail("frontier.seen.type", "must be memory, bloom or disk, got %q", c.Frontier.Seen.Type)
+	}
+	if c.Frontier.Seen.Type == "disk" && c.Frontier.Seen.Path == "" {
+		fail("frontier.seen.path", "is required for the disk seen-set")
+	}
+
+	if c.Frontier.Queue.MemoryLimit < 0 {
+		fail("frontier.queue.memory_limit", "must be 0 (never spill) or positive, got %d", c.Frontier.Queue.MemoryLimit)
+	}
+	if c.Frontier.Queue.MemoryLimit > 0 {
+		if c.Frontier.Queue.SegmentSize < 1 || c.Frontier.Queue.SegmentSize > c.Frontier.Queue.MemoryLimit {
+			fail("frontier.queue.segment_size", "must be between 1 and memory_limit (%d), got %d", c.Frontier.Queue.MemoryLimit, c.Frontier.Queue.SegmentSize)
+		}
+	}
+
+	if len(c.Processing.ContentTypes) == 0 {
+		fail("processing.content_types", "must list at least one MIME type")
+	}
+	for _, t := range c.Processing.ContentTypes {
+		if mediaType, _, err := mime.ParseMediaType(t); err != nil || mediaType != strings.ToLower(t) {
+			fail("processing.content_types", "%q is not a lowercase MIME type without parameters", t)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range c.Processing.Processors {
+		if seen[name] {
+			fail("processing.processors", "%q is listed more than once", name)
+		}
+		seen[name] = true
+	}
+
+	for i, rule := range c.Extract {
+		field := fmt.Sprintf("extract[%d]", i)
+		if rule.Name != "" {
+			field = fmt.Sprintf("extract[%s]", rule.Name)
+		}
+		if _, err := regexp.Compile(rule.URL); err != nil {
+			fail(field+".url", "invalid regexp: %v", err)
+		}
+		if len(rule.CSS)+len(rule.XPath) == 0 {
+			fail(field, "must define at least one css or xpath field")
+		}
+		for name := range rule.CSS {
+			if _, dup := rule.XPath[name]; dup {
+				fail(field, "field %q is defined as both css and xpath", name)
+			}
+		}
+	}
+
+	if c.Feeds.PollInterval.Duration <= 0 {
+		fail("feeds.poll_interval", "must be positive, got %s", c.Feeds.PollInterval)
+	}
+
+	if c.Cluster.Enabled && strings.HasPrefix(c.DSN, "sqlite://") {
+		fail("cluster.enabled", "needs a Postgres dsn, the shared frontier can't live in SQLite")
+	}
+	if c.Cluster.Enabled {
+		// budgets are counted by each process, so a cluster would spend
+		// each of them once per instance
+		for _, b := range []struct {
+			field string
+			value int64
+		}{
+			{"budget.max_pages_per_host", int64(c.Budget.MaxPagesPerHost)},
+			{"budget.max_bytes_per_host", c.Budget.MaxBytesPerHost},
+			{"budget.max_total_bytes", c.Budget.MaxTotalBytes},
+		} {
+			if b.value > 0 {
+				fail(b.field, "is counted per instance and can't be combined with cluster.enabled")
+			}
+		}
+	}
+	if c.Cluster.ClaimTimeout.Duration <= 0 {
+		fail("cluster.claim_timeout", "must be positive, got %s", c.Cluster.ClaimTimeout)
+	}
+
+	if c.Admin.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Addr); err != nil {
+			fail("admin.addr", "must be host:port, got %q", c.Admin.Addr)
+		}
+	}
+
+	if _, err := c.Logging.SlogLevel(); err != nil {
+		fail("logging.level", "must be one of debug, info, warn, error, got %q", c.Logging.Level)
+	}
+	if c.Logging.Format != "text" && c.Logging.Format != "json" {
+		fail("logging.format", "must be text or json, got %q", c.Logging.Format)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validParamPattern reports whether p is a query parameter name with at most
+// a trailing *.
+func validParamPattern(p string) bool {
+	name := strings.TrimSuffix(p, "*")
+	return name != "" && !strings.ContainsAny(name, "*=&;")
+}
+
+func (c *LoggingConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.Level))
+	return level, err
 }
@@ -0,0 +1,126 @@
+package crawler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/clock"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/crawler"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// failingStorage fails to store a page as many times as fails says for its
+// URL. A batch holding such a page fails whole, like a COPY would.
+type failingStorage struct {
+	*storage.MemoryStorage
+
+	mu    sync.Mutex
+	fails map[string]int
+}
+
+func (s *failingStorage) fail(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fails[url] == 0 {
+		return false
+	}
+	s.fails[url]--
+	return true
+}
+
+func (s *failingStorage) SavePage(ctx context.Context, p storage.Page) error {
+	if s.fail(p.URL) {
+		return errors.New("disk full")
+	}
+	return s.MemoryStorage.SavePage(ctx, p)
+}
+
+func (s *failingStorage) SavePages(ctx context.Context, pages []storage.Page) error {
+	s.mu.Lock()
+	for _, p := range pages {
+		if s.fails[p.URL] > 0 {
+			s.mu.Unlock()
+			return errors.New("batch rejected")
+		}
+	}
+	s.mu.Unlock()
+	return s.MemoryStorage.SavePages(ctx, pages)
+}
+
+func TestBatchWriterLostPages(t *testing.T) {
+	pages := map[string]string{
+		"http://a.test/": `<html><head><title>Home</title></head><body><p>Index</p>` +
+			`<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a></body></html>`,
+	}
+	for i := 1; i <= 3; i++ {
+		pages[fmt.Sprintf("http://a.test/%d", i)] = fmt.Sprintf(`<html><head><title>Page %d</title></head><body><p>Content</p></body></html>`, i)
+	}
+	fetcher := &stubFetcher{clock: clock.NewFake(time.Now()), pages: pages}
+
+	cfg := config.Default()
+	cfg.Crawler.UserAgent = "crowlr-test"
+	cfg.Crawler.Workers = 1
+	cfg.Crawler.SnapshotFile = ""
+	cfg.Crawler.CommandPollInterval.Duration = 0
+	cfg.Storage.BatchSize = 2
+	cfg.Storage.FlushInterval.Duration = 10 * time.Millisecond
+	cfg.Feeds.Enabled = false
+	cfg.Politeness.Delay.Duration = 0
+
+	// /1 is stored when fetched again, /2 never is
+	store := &failingStorage{
+		MemoryStorage: storage.NewMemoryStorage(),
+		fails:         map[string]int{"http://a.test/1": 1, "http://a.test/2": 2},
+	}
+
+	f := frontier.NewFrontier()
+	f.Push(frontier.Candidate{Original: "http://a.test/", Normalized: "http://a.test/"})
+
+	c, err := crawler.New(cfg, f, store, crawler.WithFetcher(fetcher))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.Start(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("crawl timed out")
+	}
+
+	// each lost page is fetched once more
+	if n := len(fetcher.times()); n != 6 {
+		t.Errorf("fetched %d pages, want 6", n)
+	}
+
+	stored := make(map[string]bool)
+	for _, p := range store.Pages() {
+		stored[p.URL] = true
+	}
+	for _, url := range []string{"http://a.test/", "http://a.test/1", "http://a.test/3"} {
+		if !stored[url] {
+			t.Errorf("%s not stored", url)
+		}
+	}
+	if stored["http://a.test/2"] {
+		t.Error("http://a.test/2 stored, want it lost")
+	}
+
+	stats := c.CurrentStats()
+	if stats.PagesProcessed != len(stored) {
+		t.Errorf("processed %d pages, want the %d stored", stats.PagesProcessed, len(stored))
+	}
+	if stats.PagesErrored != 3 {
+		t.Errorf("errored %d pages, want 3", stats.PagesErrored)
+	}
+	if n, _ := f.Len(); n != 0 {
+		t.Errorf("%d urls left in the frontier, want 0", n)
+	}
+}
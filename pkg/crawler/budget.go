@@ -0,0 +1,113 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/clock"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// budget tracks what each host and the whole crawl have used against the
+// configured limits. The coordinator charges it; seeds added at runtime are
+// checked against it from other goroutines.
+type budget struct {
+	cfg        config.BudgetConfig
+	clock      clock.Clock
+	mu         sync.Mutex
+	pages      map[string]int
+	bytes      map[string]int64
+	totalBytes int64
+	cutoffs    map[string]string
+}
+
+func newBudget(cfg config.BudgetConfig, cl clock.Clock) *budget {
+	return &budget{
+		cfg:     cfg,
+		clock:   cl,
+		pages:   make(map[string]int),
+		bytes:   make(map[string]int64),
+		cutoffs: make(map[string]string),
+	}
+}
+
+// charge counts one fetch of n bytes from host. It returns a cutoff when this
+// fetch used up the host's budget.
+func (b *budget) charge(host string, n int64) *storage.Cutoff {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pages[host]++
+	b.bytes[host] += n
+	b.totalBytes += n
+
+	if _, ok := b.cutoffs[host]; ok {
+		return nil
+	}
+
+	var reason string
+	switch {
+	case b.cfg.MaxPagesPerHost > 0 && b.pages[host] >= b.cfg.MaxPagesPerHost:
+		reason = fmt.Sprintf("max_pages_per_host (%d) reached", b.cfg.MaxPagesPerHost)
+	case b.cfg.MaxBytesPerHost > 0 && b.bytes[host] >= b.cfg.MaxBytesPerHost:
+		reason = fmt.Sprintf("max_bytes_per_host (%d) reached", b.cfg.MaxBytesPerHost)
+	default:
+		return nil
+	}
+
+	b.cutoffs[host] = reason
+	return &storage.Cutoff{
+		Host:   host,
+		Reason: reason,
+		Pages:  b.pages[host],
+		Bytes:  b.bytes[host],
+		CutAt:  b.clock.Now(),
+	}
+}
+
+// refund takes back one page charged to host, for a page that wasn't stored.
+// A cutoff already made stands.
+func (b *budget) refund(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pages[host] > 0 {
+		b.pages[host]--
+	}
+}
+
+// allowed reports whether rawURL's host still has budget left.
+func (b *budget) allowed(rawURL string) bool {
+	host := hostOf(rawURL)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, cut := b.cutoffs[host]
+	return !cut
+}
+
+// exhausted returns why the whole crawl must stop, or "" while it may go on.
+func (b *budget) exhausted(start time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.cfg.MaxTotalBytes > 0 && b.totalBytes >= b.cfg.MaxTotalBytes:
+		return fmt.Sprintf("max_total_bytes (%d) reached", b.cfg.MaxTotalBytes)
+	case b.cfg.MaxDuration.Duration > 0 && b.clock.Since(start) >= b.cfg.MaxDuration.Duration:
+		return fmt.Sprintf("max_duration (%s) reached", b.cfg.MaxDuration)
+	}
+	return ""
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
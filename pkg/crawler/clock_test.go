@@ -0,0 +1,163 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/clock"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/crawler"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// stubFetcher serves pages from a map and records when, on its clock, each
+// page was requested. Anything else, robots.txt included, is a 404.
+type stubFetcher struct {
+	clock *clock.Fake
+	pages map[string]string
+
+	mu      sync.Mutex
+	fetched []time.Time
+}
+
+func (f *stubFetcher) Do(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+
+	body, ok := f.pages[req.URL.String()]
+	if !ok {
+		return resp, nil
+	}
+
+	f.mu.Lock()
+	f.fetched = append(f.fetched, f.clock.Now())
+	f.mu.Unlock()
+
+	resp.StatusCode = http.StatusOK
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp.Body = io.NopCloser(strings.NewReader(body))
+	return resp, nil
+}
+
+func (f *stubFetcher) times() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.fetched...)
+}
+
+// waitFor spins until cond holds. Real time only bounds the wait, so a
+// crawler that never gets there fails the test instead of hanging it.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	giveUp := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(giveUp) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	const (
+		delay    = 10 * time.Second
+		deadline = 35 * time.Second
+	)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+
+	pages := map[string]string{
+		"http://a.test/": `<html><head><title>Home</title></head><body><p>Index</p>` +
+			`<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="/4">4</a><a href="/5">5</a></body></html>`,
+	}
+	for i := 1; i <= 5; i++ {
+		pages[fmt.Sprintf("http://a.test/%d", i)] = fmt.Sprintf(`<html><head><title>Page %d</title></head><body><p>Content</p></body></html>`, i)
+	}
+	fetcher := &stubFetcher{clock: fake, pages: pages}
+
+	cfg := config.Default()
+	cfg.Crawler.UserAgent = "crowlr-test"
+	cfg.Crawler.Workers = 1
+	cfg.Crawler.SnapshotFile = ""
+	cfg.Crawler.CommandPollInterval.Duration = 0
+	cfg.Storage.BatchSize = 0
+	cfg.Feeds.Enabled = false
+	cfg.Politeness.Delay.Duration = delay
+	cfg.Budget.MaxDuration.Duration = deadline
+
+	f := frontier.NewFrontier(frontier.WithClock(fake))
+	f.Push(frontier.Candidate{Original: "http://a.test/", Normalized: "http://a.test/"})
+
+	store := storage.NewMemoryStorage()
+	c, err := crawler.New(cfg, f, store, crawler.WithFetcher(fetcher), crawler.WithClock(fake))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		c.Start(ctx)
+		close(done)
+	}()
+
+	// The crawler is idle once it has fetched the next page and waits out
+	// the politeness delay, next to the deadline timer it set at the start.
+	// Each Advance then lets exactly one more page through.
+	for i := 1; i <= 4; i++ {
+		waitFor(t, fmt.Sprintf("fetch %d", i), func() bool {
+			return len(fetcher.times()) == i && fake.Waiters() >= 2
+		})
+		if i < 4 {
+			fake.Advance(delay)
+		}
+	}
+
+	// the fourth page went out at 30s, the next is due at 40s, so the
+	// deadline at 35s ends the crawl first
+	fake.Advance(deadline - 3*delay)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("crawl did not stop at the deadline")
+	}
+
+	got := fetcher.times()
+	if len(got) != 4 {
+		t.Fatalf("fetched %d pages, want 4", len(got))
+	}
+	for i, at := range got {
+		if want := start.Add(time.Duration(i) * delay); !at.Equal(want) {
+			t.Errorf("fetch %d at %s, want %s", i, at.Sub(start), want.Sub(start))
+		}
+	}
+
+	stats := c.CurrentStats()
+	if !strings.Contains(stats.StopReason, "max_duration") {
+		t.Errorf("stop reason %q, want max_duration", stats.StopReason)
+	}
+	if stats.PagesProcessed != 4 {
+		t.Errorf("processed %d pages, want 4", stats.PagesProcessed)
+	}
+	if elapsed := stats.Elapsed(); elapsed != deadline {
+		t.Errorf("crawl ended after %s, want %s", elapsed, deadline)
+	}
+	if n := len(store.Pages()); n != 4 {
+		t.Errorf("stored %d pages, want 4", n)
+	}
+}
@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// pollCommands applies the seeds and host blocks written to crawl_commands
+// while the crawl runs, e.g. by `crowlr seed add --live`. Commands from
+// before the crawl started are ignored. In cluster mode every instance
+// applies every command.
+func (c *Crawler) pollCommands(ctx context.Context) {
+	interval := c.cfg.Crawler.CommandPollInterval.Duration
+
+	last, err := c.store.LastCommandID(ctx)
+	if err != nil {
+		slog.Error("failed to read crawl commands, runtime commands disabled", slog.Any("err", err))
+		return
+	}
+
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		cmds, err := c.store.Commands(ctx, last)
+		if err != nil {
+			slog.Error("failed to load crawl commands", slog.Any("err", err))
+			continue
+		}
+
+		for _, cmd := range cmds {
+			c.applyCommand(ctx, cmd)
+			last = cmd.ID
+		}
+	}
+}
+
+func (c *Crawler) applyCommand(ctx context.Context, cmd storage.Command) {
+	switch cmd.Kind {
+	case storage.CommandSeed:
+		normalized, added, err := c.AddSeed(ctx, cmd.Arg)
+		if err != nil {
+			slog.Warn("seed command rejected", slog.Int64("id", cmd.ID), slog.String("url", cmd.Arg), slog.Any("err", err))
+			return
+		}
+		slog.Info("seed added", slog.Int64("id", cmd.ID), slog.String("url", normalized), slog.Bool("queued", added), slog.String("via", "command"))
+
+	case storage.CommandBlock:
+		c.BlockHost(cmd.Arg)
+		slog.Info("host blocked", slog.Int64("id", cmd.ID), slog.String("host", cmd.Arg), slog.String("via", "command"))
+
+	default:
+		slog.Warn("unknown crawl command", slog.Int64("id", cmd.ID), slog.String("kind", cmd.Kind))
+	}
+}
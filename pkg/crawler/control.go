@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	netUrl "net/url"
+	"slices"
+	"strings"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+)
+
+// control holds the operator's requests to a running crawl. It is shared by
+// the coordinator and whoever steers the crawl: signal handlers and the admin
+// API.
+type control struct {
+	paused   bool
+	draining bool
+	blocked  map[string]bool
+}
+
+// Pause stops dispatching new fetches. Fetches in flight still finish.
+func (c *Crawler) Pause() {
+	c.controlMu.Lock()
+	c.control.paused = true
+	c.controlMu.Unlock()
+	c.notify()
+}
+
+// Resume undoes Pause.
+func (c *Crawler) Resume() {
+	c.controlMu.Lock()
+	c.control.paused = false
+	c.controlMu.Unlock()
+	c.notify()
+}
+
+func (c *Crawler) Paused() bool {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	return c.control.paused
+}
+
+// Drain stops dispatching, waits for fetches in flight and makes Start
+// return with the rest of the frontier left queued.
+func (c *Crawler) Drain() {
+	c.controlMu.Lock()
+	c.control.draining = true
+	c.controlMu.Unlock()
+	c.notify()
+}
+
+func (c *Crawler) Draining() bool {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	return c.control.draining
+}
+
+// AddSeed normalizes rawURL and queues it ahead of the crawl, subject to the
+// same crawl limit, host budgets, blocks and trap checks as discovered links.
+// It returns the normalized URL and whether it was new to the frontier.
+func (c *Crawler) AddSeed(ctx context.Context, rawURL string) (string, bool, error) {
+	normalized, err := c.normalizer.Normalize(rawURL)
+	if err != nil {
+		return "", false, err
+	}
+	if u, err := netUrl.Parse(normalized); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false, fmt.Errorf("%q is not an absolute http(s) url", rawURL)
+	}
+	if limit := c.cfg.Crawler.CrawlLimit; limit > 0 && c.CurrentStats().PagesProcessed >= limit {
+		return normalized, false, fmt.Errorf("crawl_limit (%d) reached", limit)
+	}
+	if !c.budget.allowed(normalized) {
+		return normalized, false, fmt.Errorf("host of %q is cut off by its budget", rawURL)
+	}
+	if c.blocked(normalized) {
+		return normalized, false, fmt.Errorf("host of %q is blocked", rawURL)
+	}
+	if reason := c.trapped(ctx, normalized); reason != "" {
+		return normalized, false, fmt.Errorf("%q looks like a crawler trap: %s", rawURL, reason)
+	}
+
+	added := c.frontier.PushFront(frontier.Candidate{Original: rawURL, Normalized: normalized})
+	if added {
+		if c.traps != nil {
+			c.traps.Accepted(normalized)
+		}
+		c.notify()
+	}
+	return normalized, added, nil
+}
+
+// BlockHost stops the crawl from fetching host and its subdomains. Queued
+// URLs are dropped as they come up and links to them are not followed.
+func (c *Crawler) BlockHost(host string) {
+	host = strings.TrimPrefix(strings.ToLower(host), ".")
+
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	c.control.blocked[host] = true
+}
+
+// BlockedHosts returns the blocked hosts, sorted.
+func (c *Crawler) BlockedHosts() []string {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	hosts := make([]string, 0, len(c.control.blocked))
+	for h := range c.control.blocked {
+		hosts = append(hosts, h)
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+// blocked reports whether rawURL's host or one of its parent domains is
+// blocked.
+func (c *Crawler) blocked(rawURL string) bool {
+	host := hostOf(rawURL)
+
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+
+	if len(c.control.blocked) == 0 {
+		return false
+	}
+	for {
+		if c.control.blocked[host] {
+			return true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return false
+		}
+		host = parent
+	}
+}
+
+// CurrentStats returns a copy of the crawl's counters that is safe to read
+// while the crawl runs.
+func (c *Crawler) CurrentStats() CrawlStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.Stats
+}
+
+// QueueLen returns how many URLs are queued or in flight.
+func (c *Crawler) QueueLen() (int, error) {
+	return c.frontier.Len()
+}
@@ -2,14 +2,20 @@ package crawler
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/benjaminestes/robots"
 	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/clock"
 	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/dnscache"
 	"github.com/devraulu/crowlr/pkg/process"
 	"github.com/devraulu/crowlr/pkg/storage"
+	"golang.org/x/sync/singleflight"
 )
 
 type CrawlStats struct {
@@ -17,10 +23,17 @@ type CrawlStats struct {
 	PagesProcessed int
 	PagesErrored   int
 	PagesSkipped   int
+	// StopReason says which limit ended the crawl, if any
+	StopReason string
+	// clock is the crawler's, which StartTime was read from
+	clock clock.Clock
 }
 
 func (s *CrawlStats) Elapsed() time.Duration {
-	return time.Since(s.StartTime)
+	if s.clock == nil {
+		return time.Since(s.StartTime)
+	}
+	return s.clock.Since(s.StartTime)
 }
 
 func (s *CrawlStats) PagesPerSecond() float64 {
@@ -32,11 +45,43 @@ func (s *CrawlStats) PagesPerSecond() float64 {
 }
 
 type Crawler struct {
-	cfg         *config.Config
-	frontier    *frontier.Frontier
-	store       storage.Storage
+	cfg        *config.Config
+	frontier   frontier.Queue
+	store      storage.Storage
+	pipeline   *process.Pipeline
+	budget     *budget
+	normalizer *process.Normalizer
+	traps      *frontier.TrapDetector
+	content    *process.ContentHandlers
+	// group finds the politeness group of outlinks in the workers, so the
+	// frontier needn't look them up on the coordinator
+	group       frontier.KeyFunc
+	fetcher     Fetcher
+	clock       clock.Clock
+	resolver    *dnscache.Resolver
+	robotsMu    sync.Mutex
 	robotsCache map[string]*robots.Robots
-	Stats       CrawlStats
+	// robotsFetch makes callers wanting the same robots.txt share one fetch
+	robotsFetch singleflight.Group
+	wake        chan struct{}
+	// writer batches page writes when storage.batch_size is set
+	writer   *storage.BatchWriter
+	writesMu sync.Mutex
+	// unwritten holds the candidates of pages handed to the writer until
+	// it reports on them, and lost those it failed to write
+	unwritten map[string]frontier.Candidate
+	lost      []lostPage
+	// retried marks URLs fetched again after their page was lost. Only the
+	// coordinator uses it.
+	retried map[string]bool
+	// resumedAfter is the time spent by the crawl this one resumes
+	resumedAfter time.Duration
+	controlMu    sync.Mutex
+	control      control
+	// statsMu guards writes to Stats, which only the coordinator makes, so
+	// CurrentStats can read it from other goroutines
+	statsMu sync.Mutex
+	Stats   CrawlStats
 }
 
 type Job struct {
@@ -45,17 +90,106 @@ type Job struct {
 	url      string
 }
 
-func New(cfg *config.Config, f *frontier.Frontier, s storage.Storage) *Crawler {
-	return &Crawler{
+// Fetcher sends the crawler's HTTP requests: pages, feeds and robots.txt.
+// The default is an *http.Client dialing through the crawler's resolver.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Option configures a Crawler.
+type Option func(*Crawler)
+
+// WithFetcher makes the crawler send its requests through f, e.g. to serve
+// recorded responses without network access. The resolver is then only used
+// for politeness groups by address.
+func WithFetcher(f Fetcher) Option {
+	return func(c *Crawler) {
+		c.fetcher = f
+	}
+}
+
+// WithClock sets the clock the crawler times fetches, waits and limits with.
+// Give the frontier the same clock. The default is the system clock.
+func WithClock(cl clock.Clock) Option {
+	return func(c *Crawler) {
+		c.clock = cl
+	}
+}
+
+// WithResolver makes the crawler connect through r, sharing its DNS cache
+// with the frontier's politeness groups.
+func WithResolver(r *dnscache.Resolver) Option {
+	return func(c *Crawler) {
+		c.resolver = r
+	}
+}
+
+func New(cfg *config.Config, f frontier.Queue, s storage.Storage, opts ...Option) (*Crawler, error) {
+	pipeline, err := process.NewPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := process.NewContentHandlers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Crawler{
 		cfg:         cfg,
 		frontier:    f,
 		store:       s,
+		pipeline:    pipeline,
+		content:     content,
+		clock:       clock.Real,
+		normalizer:  process.NewNormalizer(cfg.Normalize),
 		robotsCache: make(map[string]*robots.Robots),
+		wake:        make(chan struct{}, 1),
+		control:     control{blocked: make(map[string]bool)},
+		unwritten:   make(map[string]frontier.Candidate),
+		retried:     make(map[string]bool),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if cfg.Storage.BatchSize > 0 {
+		c.writer = storage.NewBatchWriter(s, cfg.Storage.BatchSize, cfg.Storage.FlushInterval.Duration, c.pageWritten)
+		c.store = c.writer
+	}
+
+	c.budget = newBudget(cfg.Budget, c.clock)
+
+	if cfg.Traps.Enabled {
+		c.traps = frontier.NewTrapDetector(cfg.Traps, c.clock)
+	}
+
+	if c.resolver == nil {
+		c.resolver = dnscache.New(cfg.Politeness.DNSCacheTTL.Duration)
+	}
+
+	c.group, err = frontier.NewKeyFunc(cfg.Politeness.Group, c.resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.fetcher == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = c.resolver.DialContext
+		c.fetcher = &http.Client{
+			Timeout:   time.Second * 10,
+			Transport: transport,
+		}
+	}
+
+	return c, nil
 }
 
 func (c *Crawler) Start(ctx context.Context) {
-	c.Stats.StartTime = time.Now()
+	c.countStats(func(s *CrawlStats) {
+		s.StartTime = c.clock.Now().Add(-c.resumedAfter)
+		s.clock = c.clock
+	})
 
 	jobs := make(chan frontier.Candidate, c.cfg.Crawler.Workers)
 	results := make(chan CrawlResult, c.cfg.Crawler.Workers)
@@ -64,21 +198,70 @@ func (c *Crawler) Start(ctx context.Context) {
 		go c.worker(ctx, i, jobs, results)
 	}
 
+	if c.cfg.Feeds.Enabled {
+		// stops polling when the crawl ends before ctx does
+		pollCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go c.pollFeeds(pollCtx)
+	}
+
+	if c.cfg.Crawler.CommandPollInterval.Duration > 0 {
+		cmdCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go c.pollCommands(cmdCtx)
+	}
+
 	c.coordinator(ctx, jobs, results)
 
+	if c.writer != nil {
+		// settles the pages still queued, so a lost one is back in the
+		// frontier before a drain snapshot is taken
+		c.writer.Close()
+		c.settleLost()
+	}
+
 	slog.Info("crawl complete",
 		slog.Int("processed", c.Stats.PagesProcessed),
 		slog.Int("errored", c.Stats.PagesErrored),
 		slog.Int("skipped", c.Stats.PagesSkipped),
 		slog.Duration("elapsed", c.Stats.Elapsed()),
 		slog.Float64("pages_per_sec", c.Stats.PagesPerSecond()),
+		slog.String("stop_reason", c.Stats.StopReason),
 	)
 }
 
+// idleWait is how often the coordinator checks the frontier again while
+// nothing is queued and the URLs in flight aren't its own, such as feed polls
+// or other cluster instances' claims.
+const idleWait = 100 * time.Millisecond
+
 func (c *Crawler) coordinator(ctx context.Context, jobs chan<- frontier.Candidate, results <-chan CrawlResult) {
 	activeWorkers := 0
+	// pending holds a popped candidate until a worker is free to take it
+	var pending *frontier.Candidate
+
+	// wakes the loop when the crawl runs out of time
+	var deadline <-chan time.Time
+	if d := c.cfg.Budget.MaxDuration.Duration; d > 0 {
+		deadline = c.clock.After(d - c.Stats.Elapsed())
+	}
+
+	// failure stops the crawl when the frontier can't be read
+	var failure string
+
 	for {
-		if c.cfg.Crawler.CrawlLimit > 0 && c.Stats.PagesProcessed >= c.cfg.Crawler.CrawlLimit {
+		c.settleLost()
+
+		reason := failure
+		if reason == "" {
+			reason = c.stopReason()
+		}
+		if reason != "" {
+			c.countStats(func(s *CrawlStats) { s.StopReason = reason })
+			slog.Info("crawl stopping, finishing in-flight pages", slog.String("reason", reason), slog.Int("active_workers", activeWorkers))
+			if pending != nil {
+				c.frontier.Requeue(*pending)
+			}
 			for activeWorkers > 0 {
 				select {
 				case res := <-results:
@@ -91,92 +274,340 @@ func (c *Crawler) coordinator(ctx context.Context, jobs chan<- frontier.Candidat
 			return
 		}
 
-		var candidate *frontier.Candidate
-		var jobsChan chan<- frontier.Candidate
-		var waitTime time.Duration
+		var wait <-chan time.Time
 
-		if c.frontier.Len() > 0 {
-			candidate, waitTime = c.frontier.Pop(c.cfg.Politeness.GetDelay())
-			if candidate == nil {
-				slog.Info("frontier empty and no active workers. mission complete.")
-				return
-			}
-			if candidate.Normalized != "" {
-				r := process.CheckRobots(candidate.Normalized, c.robotsCache)
-				if r != nil && !r.Test(c.cfg.Crawler.UserAgent, candidate.Normalized) {
+		if pending == nil && !c.Paused() {
+			candidate, waitTime := c.frontier.Pop(c.cfg.Politeness.Delay.Duration)
+			if candidate != nil {
+				if !c.allowedByRobots(candidate.Normalized) {
 					slog.Info("robots.txt disallowed", slog.Any("candidate", candidate))
+					c.frontier.Done(candidate.Normalized)
 					continue
 				}
-
-				jobsChan = jobs
-			} else if waitTime > 0 {
-				time.Sleep(waitTime)
+				if !c.budget.allowed(candidate.Normalized) {
+					slog.Debug("host cut off, dropping", slog.Any("candidate", candidate))
+					c.frontier.Done(candidate.Normalized)
+					continue
+				}
+				if c.blocked(candidate.Normalized) {
+					slog.Debug("host blocked, dropping", slog.Any("candidate", candidate))
+					c.frontier.Done(candidate.Normalized)
+					continue
+				}
+				pending = candidate
+			} else if queued, err := c.frontier.Len(); err != nil {
+				slog.Error("frontier unavailable, stopping the crawl", slog.Any("err", err))
+				failure = fmt.Sprintf("frontier unavailable: %v", err)
 				continue
+			} else if queued > 0 {
+				// every queued host is still waiting out its delay, or
+				// nothing is queued but URLs in flight may queue more: our
+				// workers' results wake the loop, others are polled for
+				if waitTime > 0 {
+					wait = c.clock.After(waitTime)
+				} else if activeWorkers == 0 {
+					wait = c.clock.After(idleWait)
+				}
+			} else if activeWorkers == 0 && !c.cfg.Feeds.Enabled {
+				slog.Info("frontier empty and no active workers. mission complete.")
+				return
 			}
-		} else if activeWorkers == 0 {
-			slog.Info("frontier empty and no active workers. mission complete.")
-			return
 		}
 
-		if candidate != nil {
-			select {
-			case jobsChan <- *candidate:
-				activeWorkers++
-				slog.Info("job dispatched", slog.Any("candidate", candidate), slog.Int("active_workers", activeWorkers), slog.Int("seen", c.frontier.Len()))
+		var jobsChan chan<- frontier.Candidate
+		var next frontier.Candidate
+		if pending != nil && !c.Paused() {
+			jobsChan = jobs
+			next = *pending
+		}
 
-			case res := <-results:
-				activeWorkers--
-				c.processResult(ctx, res)
+		select {
+		case jobsChan <- next:
+			activeWorkers++
+			pending = nil
+			slog.Info("job dispatched", slog.Any("candidate", next), slog.Int("active_workers", activeWorkers))
 
-			case <-ctx.Done():
-				return
-			}
-		} else {
-			select {
-			case res := <-results:
-				activeWorkers--
-				c.processResult(ctx, res)
-			case <-ctx.Done():
-				return
-			}
+		case res := <-results:
+			activeWorkers--
+			c.processResult(ctx, res)
+
+		case <-wait:
+
+		case <-deadline:
+
+		case <-c.wake:
+
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
 func (c *Crawler) processResult(ctx context.Context, res CrawlResult) {
+	if ctx.Err() == nil {
+		c.frontier.Report(res.URL, res.Latency, res.StatusCode)
+	}
+	// a page's URL is done once the page is stored, see savePage
+	if res.PageData == nil {
+		c.frontier.Done(res.URL)
+	}
+
+	if res.StatusCode != 0 {
+		if cut := c.budget.charge(hostOf(res.URL), res.Bytes); cut != nil {
+			slog.Warn("host cut off", slog.String("host", cut.Host), slog.String("reason", cut.Reason), slog.Int("pages", cut.Pages), slog.Int64("bytes", cut.Bytes))
+			if err := c.store.SaveCutoff(ctx, *cut); err != nil {
+				slog.Error("failed to save cutoff", slog.String("host", cut.Host), slog.Any("err", err))
+			}
+		}
+	}
+
 	if res.Error != nil {
-		c.Stats.PagesErrored++
+		c.countStats(func(s *CrawlStats) { s.PagesErrored++ })
 		slog.Error("crawl failed", slog.String("url", res.URL), slog.Any("err", res.Error))
 		return
 	}
 
 	if res.PageData == nil {
-		c.Stats.PagesSkipped++
-		return
+		c.countStats(func(s *CrawlStats) { s.PagesSkipped++ })
+	} else if c.savePage(ctx, res) {
+		c.countStats(func(s *CrawlStats) { s.PagesProcessed++ })
+		slog.Info("crawl success",
+			slog.String("url", res.URL),
+			slog.Int("outlinks", len(res.Outlinks)),
+			slog.Int("processed", c.Stats.PagesProcessed),
+			slog.Float64("pages_per_sec", c.Stats.PagesPerSecond()),
+		)
 	}
 
-	c.Stats.PagesProcessed++
-	slog.Info("crawl success",
-		slog.String("url", res.URL),
-		slog.Int("outlinks", len(res.Outlinks)),
-		slog.Int("processed", c.Stats.PagesProcessed),
-		slog.Float64("pages_per_sec", c.Stats.PagesPerSecond()),
-	)
-
-	if err := c.store.SavePage(ctx, *res.PageData); err != nil {
-		c.Stats.PagesErrored++
-		slog.Error("failed to save page", slog.String("url", res.URL), slog.Any("err", err))
+	for _, feed := range res.Feeds {
+		if err := c.store.SaveFeed(ctx, storage.Feed{URL: feed, SiteURL: res.URL}); err != nil {
+			slog.Error("failed to save feed", slog.String("url", feed), slog.Any("err", err))
+		}
 	}
 
 	for _, link := range res.Outlinks {
 		if c.cfg.Crawler.CrawlLimit > 0 && c.Stats.PagesProcessed >= c.cfg.Crawler.CrawlLimit {
 			slog.Info("crawl limit reached, stopping outlink push",
 				slog.Int("processed", c.Stats.PagesProcessed),
-				slog.Int("queued", c.frontier.Len()),
 				slog.Int("limit", c.cfg.Crawler.CrawlLimit),
 			)
 			break
 		}
-		c.frontier.Push(link.Normalized, link.Original, res.URL)
+		if res.Seed != nil && !res.Seed.Follows(link.Normalized, res.Depth+1) {
+			continue
+		}
+		if !c.admits(ctx, link.Normalized) {
+			continue
+		}
+		priority := link.Priority
+		if priority == 0 && res.Seed != nil {
+			priority = res.Seed.Priority
+		}
+		added := c.frontier.Push(frontier.Candidate{
+			Original:   link.Original,
+			Normalized: link.Normalized,
+			Referrer:   res.URL,
+			Depth:      res.Depth + 1,
+			Priority:   priority,
+			Seed:       res.Seed,
+			Group:      link.Group,
+		})
+		if added {
+			c.accepted(link.Normalized)
+		}
+	}
+}
+
+// lostPage is a page the batch writer failed to write.
+type lostPage struct {
+	candidate frontier.Candidate
+	err       error
+}
+
+// savePage stores the page of res, or hands it to the batch writer, and
+// reports whether it did. The page's URL is done once it is stored; until
+// then it stays in flight, so a lost page can be fetched again.
+func (c *Crawler) savePage(ctx context.Context, res CrawlResult) bool {
+	candidate := frontier.Candidate{
+		Original:   res.PageData.RawURL,
+		Normalized: res.URL,
+		Referrer:   res.PageData.Referrer,
+		Depth:      res.Depth,
+		Seed:       res.Seed,
+	}
+
+	if c.writer != nil {
+		c.writesMu.Lock()
+		c.unwritten[res.URL] = candidate
+		c.writesMu.Unlock()
+	}
+
+	err := c.store.SavePage(ctx, *res.PageData)
+	if err == nil {
+		if c.writer == nil {
+			c.frontier.Done(res.URL)
+		}
+		return true
+	}
+
+	if c.writer != nil {
+		c.writesMu.Lock()
+		delete(c.unwritten, res.URL)
+		c.writesMu.Unlock()
+	}
+	c.countStats(func(s *CrawlStats) { s.PagesErrored++ })
+	c.retryPage(candidate, err)
+	return false
+}
+
+// pageWritten is the batch writer's report on page p. A stored page's URL is
+// done; a lost one is left for the coordinator, which counted it as
+// processed when it was queued.
+func (c *Crawler) pageWritten(p storage.Page, err error) {
+	c.writesMu.Lock()
+	candidate, ok := c.unwritten[p.URL]
+	delete(c.unwritten, p.URL)
+	lost := ok && err != nil
+	if lost {
+		c.lost = append(c.lost, lostPage{candidate: candidate, err: err})
+	}
+	c.writesMu.Unlock()
+
+	if lost {
+		c.notify()
+		return
+	}
+	c.frontier.Done(p.URL)
+}
+
+// settleLost counts the pages the batch writer lost as errored instead of
+// processed, and retries them.
+func (c *Crawler) settleLost() {
+	c.writesMu.Lock()
+	lost := c.lost
+	c.lost = nil
+	c.writesMu.Unlock()
+
+	for _, l := range lost {
+		c.countStats(func(s *CrawlStats) {
+			s.PagesProcessed--
+			s.PagesErrored++
+		})
+		c.retryPage(l.candidate, l.err)
+	}
+}
+
+// retryPage puts the URL of a page that couldn't be stored back in the
+// frontier to be fetched again, once, and refunds the fetch from its host's
+// page budget.
+func (c *Crawler) retryPage(candidate frontier.Candidate, err error) {
+	c.budget.refund(hostOf(candidate.Normalized))
+
+	if c.retried[candidate.Normalized] {
+		slog.Error("page lost", slog.String("url", candidate.Normalized), slog.Any("err", err))
+		c.frontier.Done(candidate.Normalized)
+		return
+	}
+	c.retried[candidate.Normalized] = true
+	slog.Warn("failed to save page, fetching it again", slog.String("url", candidate.Normalized), slog.Any("err", err))
+	c.frontier.Requeue(candidate)
+}
+
+// admits reports whether a discovered URL may be queued: its host has
+// budget left and isn't blocked, and it doesn't look like part of a trap.
+func (c *Crawler) admits(ctx context.Context, url string) bool {
+	if !c.budget.allowed(url) || c.blocked(url) {
+		return false
+	}
+	return c.trapped(ctx, url) == ""
+}
+
+// accepted counts a URL the frontier took as new towards its trap pattern.
+func (c *Crawler) accepted(url string) {
+	if c.traps != nil {
+		c.traps.Accepted(url)
+	}
+}
+
+// trapped returns why url looks like part of a crawler trap, or "" if it
+// doesn't, recording the pattern the first time it is quarantined.
+func (c *Crawler) trapped(ctx context.Context, url string) string {
+	if c.traps == nil {
+		return ""
+	}
+
+	reason, q := c.traps.Check(url)
+	if reason == "" {
+		return ""
+	}
+
+	slog.Debug("trap url skipped", slog.String("url", url), slog.String("reason", reason))
+	if q != nil {
+		slog.Warn("url pattern quarantined", slog.String("host", q.Host), slog.String("pattern", q.Pattern), slog.String("reason", q.Reason), slog.Int("urls", q.URLs))
+		if err := c.store.SaveQuarantine(ctx, *q); err != nil {
+			slog.Error("failed to save quarantine", slog.String("host", q.Host), slog.String("pattern", q.Pattern), slog.Any("err", err))
+		}
+	}
+	return reason
+}
+
+// stopReason returns why the crawl must stop dispatching, or "" while it may
+// go on.
+func (c *Crawler) stopReason() string {
+	if c.Draining() {
+		return "drain requested"
+	}
+	if c.cfg.Crawler.CrawlLimit > 0 && c.Stats.PagesProcessed >= c.cfg.Crawler.CrawlLimit {
+		return fmt.Sprintf("crawl_limit (%d) reached", c.cfg.Crawler.CrawlLimit)
+	}
+	return c.budget.exhausted(c.Stats.StartTime)
+}
+
+func (c *Crawler) allowedByRobots(url string) bool {
+	robotsURL, err := robots.Locate(url)
+	if err != nil {
+		return true
+	}
+
+	r := c.robotsFor(robotsURL)
+	return r == nil || r.Test(c.cfg.Crawler.UserAgent, url)
+}
+
+// robotsFor returns the cached rules at robotsURL, fetching them the first
+// time. The lock only guards the cache, so a slow robots.txt holds up the
+// callers waiting on that host and no others.
+func (c *Crawler) robotsFor(robotsURL string) *robots.Robots {
+	c.robotsMu.Lock()
+	r, ok := c.robotsCache[robotsURL]
+	c.robotsMu.Unlock()
+	if ok {
+		return r
+	}
+
+	v, _, _ := c.robotsFetch.Do(robotsURL, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Politeness.RobotsTimeout.Duration)
+		defer cancel()
+
+		r := process.FetchRobots(ctx, c.fetcher, robotsURL)
+		c.robotsMu.Lock()
+		c.robotsCache[robotsURL] = r
+		c.robotsMu.Unlock()
+		return r, nil
+	})
+	return v.(*robots.Robots)
+}
+
+// countStats applies update to Stats under statsMu.
+func (c *Crawler) countStats(update func(s *CrawlStats)) {
+	c.statsMu.Lock()
+	update(&c.Stats)
+	c.statsMu.Unlock()
+}
+
+// notify wakes the coordinator after URLs were queued from outside it.
+func (c *Crawler) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
 	}
 }
@@ -0,0 +1,205 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/process"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// feedBatch is how many due feeds are fetched from storage per check.
+const feedBatch = 50
+
+const feedAccept = "application/rss+xml, application/atom+xml, application/rdf+xml;q=0.9, application/xml;q=0.8, text/xml;q=0.8"
+
+// pollFeeds polls every known feed once per poll interval and queues entries
+// published since the previous poll ahead of the rest of the frontier. Newly
+// discovered feeds are picked up within a minute. Feed fetches keep to their
+// host's politeness delay, shared with the page fetches.
+func (c *Crawler) pollFeeds(ctx context.Context) {
+	interval := c.cfg.Feeds.PollInterval.Duration
+	ticker := c.clock.NewTicker(min(interval, time.Minute))
+	defer ticker.Stop()
+
+	slog.Info("feed poller started", slog.Duration("poll_interval", interval))
+	for {
+		feeds, err := c.store.DueFeeds(ctx, c.clock.Now().Add(-interval), feedBatch)
+		if err != nil {
+			slog.Error("failed to load due feeds", slog.Any("err", err))
+		}
+
+		if !c.pollDue(ctx, feeds) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// pollDue polls feeds as their hosts become due, waiting for the soonest
+// when none is. It returns false if ctx ended first.
+func (c *Crawler) pollDue(ctx context.Context, feeds []storage.Feed) bool {
+	for len(feeds) > 0 {
+		var later []storage.Feed
+		var next time.Duration
+		for _, f := range feeds {
+			if ctx.Err() != nil {
+				return false
+			}
+
+			wait, err := c.frontier.Reserve(f.URL, c.cfg.Politeness.Delay.Duration)
+			if err != nil {
+				slog.Error("failed to reserve feed host", slog.String("url", f.URL), slog.Any("err", err))
+				continue
+			}
+			if wait > 0 {
+				later = append(later, f)
+				if next == 0 || wait < next {
+					next = wait
+				}
+				continue
+			}
+
+			c.pollFeed(ctx, f)
+		}
+
+		feeds = later
+		if len(feeds) > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-c.clock.After(next):
+			}
+		}
+	}
+	return true
+}
+
+// pollFeed fetches f, whose host was reserved for it, and records the result.
+func (c *Crawler) pollFeed(ctx context.Context, f storage.Feed) {
+	defer c.frontier.Done(f.URL)
+
+	now := c.clock.Now()
+	f.LastPolled = &now
+
+	queued, err := c.fetchFeed(ctx, &f)
+	if err != nil {
+		f.ErrorCount++
+		slog.Warn("feed poll failed", slog.String("url", f.URL), slog.Int("errors", f.ErrorCount), slog.Any("err", err))
+	} else {
+		f.ErrorCount = 0
+		slog.Info("feed polled", slog.String("url", f.URL), slog.Int("status", f.StatusCode), slog.Int("queued", queued))
+	}
+
+	if err := c.store.UpdateFeed(ctx, f); err != nil {
+		slog.Error("failed to update feed", slog.String("url", f.URL), slog.Any("err", err))
+	}
+
+	if queued > 0 {
+		c.notify()
+	}
+}
+
+// fetchFeed fetches f with a conditional GET and pushes the URLs of entries
+// newer than f.LastEntryAt to the front of the frontier. It updates f with
+// the response validators and returns how many entries were queued.
+func (c *Crawler) fetchFeed(ctx context.Context, f *storage.Feed) (int, error) {
+	if !c.allowedByRobots(f.URL) {
+		return 0, errors.New("disallowed by robots.txt")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", f.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Add("Accept", feedAccept)
+	req.Header.Add("User-Agent", c.cfg.Crawler.UserAgent)
+	if f.ETag != "" {
+		req.Header.Add("If-None-Match", f.ETag)
+	}
+	if f.LastModified != "" {
+		req.Header.Add("If-Modified-Since", f.LastModified)
+	}
+
+	start := c.clock.Now()
+	resp, err := c.fetcher.Do(req)
+	if err != nil {
+		c.frontier.Report(f.URL, c.clock.Since(start), 0)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	c.frontier.Report(f.URL, c.clock.Since(start), resp.StatusCode)
+
+	f.StatusCode = resp.StatusCode
+	if resp.StatusCode == http.StatusNotModified {
+		return 0, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.Crawler.MaxBodyBytes))
+	if err != nil {
+		return 0, err
+	}
+
+	feed, err := process.ParseFeed(body)
+	if err != nil {
+		return 0, err
+	}
+
+	f.Title = feed.Title
+	f.ETag = resp.Header.Get("ETag")
+	f.LastModified = resp.Header.Get("Last-Modified")
+
+	base, err := url.Parse(f.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	latest := f.LastEntryAt
+	for _, e := range feed.Entries {
+		if e.Published != nil {
+			if f.LastEntryAt != nil && !e.Published.After(*f.LastEntryAt) {
+				continue
+			}
+			if latest == nil || e.Published.After(*latest) {
+				latest = e.Published
+			}
+		}
+
+		ref, err := url.Parse(e.Link)
+		if err != nil || e.Link == "" {
+			continue
+		}
+		link := base.ResolveReference(ref).String()
+
+		normalized, err := c.normalizer.Normalize(link)
+		if err != nil || !c.admits(ctx, normalized) {
+			continue
+		}
+
+		// already seen entries are dropped by the frontier
+		if c.frontier.PushFront(frontier.Candidate{Original: link, Normalized: normalized, Referrer: f.URL}) {
+			c.accepted(normalized)
+			queued++
+		}
+	}
+	f.LastEntryAt = latest
+
+	return queued, nil
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+)
+
+// state is the progress a drained crawl hands over to the crawl resuming
+// it, besides the frontier: budget counters and cutoffs, page counts and
+// time spent, so limits hold across the two, and the blocked hosts.
+type state struct {
+	Pages      map[string]int
+	Bytes      map[string]int64
+	TotalBytes int64
+	Cutoffs    map[string]string
+	Processed  int
+	Errored    int
+	Skipped    int
+	Elapsed    time.Duration
+	Blocked    []string
+}
+
+// SaveState encodes the crawl's progress for RestoreState, e.g. in a
+// frontier snapshot. Call it once Start has returned.
+func (c *Crawler) SaveState() ([]byte, error) {
+	st := c.CurrentStats()
+	s := state{
+		Processed: st.PagesProcessed,
+		Errored:   st.PagesErrored,
+		Skipped:   st.PagesSkipped,
+		Elapsed:   st.Elapsed(),
+		Blocked:   c.BlockedHosts(),
+	}
+
+	c.budget.mu.Lock()
+	defer c.budget.mu.Unlock()
+	s.Pages, s.Bytes, s.TotalBytes, s.Cutoffs = c.budget.pages, c.budget.bytes, c.budget.totalBytes, c.budget.cutoffs
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RestoreState picks up the progress saved by SaveState. Call it before
+// Start.
+func (c *Crawler) RestoreState(data []byte) error {
+	var s state
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return err
+	}
+
+	for host, n := range s.Pages {
+		c.budget.pages[host] = n
+	}
+	for host, n := range s.Bytes {
+		c.budget.bytes[host] = n
+	}
+	for host, reason := range s.Cutoffs {
+		c.budget.cutoffs[host] = reason
+	}
+	c.budget.totalBytes = s.TotalBytes
+
+	for _, host := range s.Blocked {
+		c.BlockHost(host)
+	}
+
+	c.countStats(func(st *CrawlStats) {
+		st.PagesProcessed = s.Processed
+		st.PagesErrored = s.Errored
+		st.PagesSkipped = s.Skipped
+	})
+	c.resumedAfter = s.Elapsed
+	return nil
+}
@@ -1,15 +1,32 @@
 package crawler
 
-import "github.com/devraulu/crowlr/pkg/storage"
+import (
+	"time"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
 
 type Outlink struct {
 	Normalized string
 	Original   string
+	Priority   float64
+	// Group is the politeness group of the link's host
+	Group string
 }
 
 type CrawlResult struct {
-	URL      string
-	Error    error
+	URL   string
+	Depth int
+	// Seed holds the options of the seed the page was reached from
+	Seed  *frontier.SeedOptions
+	Error error
+	// StatusCode and Latency describe the response, if there was one
+	StatusCode int
+	Latency    time.Duration
+	// Bytes is the size of the downloaded body
+	Bytes    int64
 	PageData *storage.Page
 	Outlinks []Outlink
+	Feeds    []string
 }
@@ -1,12 +1,10 @@
 package crawler
 
 import (
-	"bytes"
 	"context"
 	"io"
 	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 
 	frontier "github.com/devraulu/crowlr/pkg"
@@ -25,85 +23,130 @@ func (c *Crawler) worker(ctx context.Context, id int, jobs <-chan frontier.Candi
 				return
 			}
 			slog.Debug("worker received job", slog.Int("id", id), slog.Any("job", job))
-			results <- c.fetchAndProcess(job)
+			results <- c.fetchAndProcess(ctx, job)
 		}
 	}
 }
 
-func (c *Crawler) fetchAndProcess(job frontier.Candidate) CrawlResult {
+func (c *Crawler) fetchAndProcess(ctx context.Context, job frontier.Candidate) CrawlResult {
 	res := CrawlResult{
-		URL: job.Normalized,
+		URL:   job.Normalized,
+		Depth: job.Depth,
+		Seed:  job.Seed,
 	}
 
-	req, err := http.NewRequest("GET", job.Normalized, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", job.Normalized, nil)
 	if err != nil {
 		res.Error = err
 		return res
 	}
 
-	req.Header.Add("Accept", "text/html")
+	req.Header.Add("Accept", c.content.Accept())
 	req.Header.Add("User-Agent", c.cfg.Crawler.UserAgent)
 
-	client := &http.Client{
-		Timeout: time.Second * 10,
+	start := c.clock.Now()
+	resp, err := c.fetcher.Do(req)
+	res.Latency = c.clock.Since(start)
+	if err != nil {
+		res.Error = err
+		return res
+	}
+	defer resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+
+	// skip unwanted types before downloading them when the server says what
+	// it is sending
+	if mediaType := process.MediaType(resp, nil); mediaType != "application/octet-stream" {
+		if _, ok := c.content.For(mediaType); !ok {
+			slog.Debug("unsupported content type", slog.String("url", job.Normalized), slog.String("content_type", mediaType))
+			return res
+		}
 	}
 
-	resp, err := client.Do(req)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.cfg.Crawler.MaxBodyBytes+1))
+	res.Bytes = int64(len(body))
 	if err != nil {
 		res.Error = err
 		return res
 	}
-	defer resp.Body.Close()
 
-	if !validateHTMLContentTypeHeader(resp, "text/html") {
+	if int64(len(body)) > c.cfg.Crawler.MaxBodyBytes {
+		slog.Info("body too large, skipping", slog.String("url", job.Normalized), slog.Int64("max_body_bytes", c.cfg.Crawler.MaxBodyBytes))
 		return res
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		res.Error = err
+	mediaType := process.MediaType(resp, body)
+	handler, ok := c.content.For(mediaType)
+	if !ok {
+		slog.Debug("unsupported content type", slog.String("url", job.Normalized), slog.String("content_type", mediaType))
 		return res
 	}
 
-	if !validateBodyContentType(body, "text/html") {
+	var lastMod *time.Time
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			lastMod = &t
+		}
+	}
+
+	doc := &process.Document{
+		URL:      job.Normalized,
+		Response: resp,
+		Body:     body,
+		Page: &storage.Page{
+			Referrer:     job.Referrer,
+			RawURL:       job.Original,
+			URL:          job.Normalized,
+			Timestamp:    c.clock.Now(),
+			LastModified: lastMod,
+			ContentType:  mediaType,
+			StatusCode:   resp.StatusCode,
+		},
+	}
+	if job.Seed != nil {
+		doc.Page.Tags = job.Seed.Tags
+	}
+
+	if err := handler.Handle(ctx, doc); err != nil {
+		res.Error = err
 		return res
 	}
 
-	extracted, err := process.ExtractLinks(bytes.NewReader(body), job.Normalized)
-	if err != nil {
+	if err := c.pipeline.Run(ctx, doc); err != nil {
 		res.Error = err
 		return res
 	}
 
 	var outlinks []Outlink
 
-	for _, absolute := range extracted.Outlinks {
-		normalized, err := process.Normalize(absolute)
-		if err == nil {
-			outlinks = append(outlinks, Outlink{
-				Normalized: normalized,
-				Original:   absolute,
-			})
+	for _, absolute := range doc.Outlinks {
+		normalized, err := c.normalizer.Normalize(absolute)
+		if err != nil {
+			continue
+		}
+		group, err := c.group.Group(normalized)
+		if err != nil {
+			continue
 		}
+		outlinks = append(outlinks, Outlink{
+			Normalized: normalized,
+			Original:   absolute,
+			Priority:   doc.Priorities[absolute],
+			Group:      group,
+		})
 	}
 
 	res.Outlinks = outlinks
 
-	textContent, err := process.ExtractText(bytes.NewReader(body))
-	if err != nil {
-		slog.Warn("failed to extract text",
-			slog.String("url", job.Normalized),
-			slog.Any("err", err))
-
-		textContent = ""
-		// continue even if text extraction fails
+	for _, feed := range doc.Feeds {
+		if normalized, err := c.normalizer.Normalize(feed); err == nil {
+			res.Feeds = append(res.Feeds, normalized)
+		}
 	}
 
-	var lastMod *time.Time
-	if lm := resp.Header.Get("Last-Modified"); lm != "" {
-		if t, err := http.ParseTime(lm); err == nil {
-			lastMod = &t
-		}
+	if reason, skipped := doc.Skipped(); skipped {
+		slog.Info("page skipped by processor", slog.String("url", job.Normalized), slog.String("reason", reason))
+		return res
 	}
 
 	storageOutlinks := make([]string, len(outlinks))
@@ -111,28 +154,8 @@ func (c *Crawler) fetchAndProcess(job frontier.Candidate) CrawlResult {
 		storageOutlinks[i] = o.Normalized
 	}
 
-	res.PageData = &storage.Page{
-		Referrer:     job.Referrer,
-		RawURL:       job.Original,
-		URL:          job.Normalized,
-		Timestamp:    time.Now(),
-		LastModified: lastMod,
-		Title:        extracted.Title,
-		Content:      textContent,
-		HTML:         string(body),
-		StatusCode:   resp.StatusCode,
-		Outlinks:     storageOutlinks,
-	}
+	doc.Page.Outlinks = storageOutlinks
+	res.PageData = doc.Page
 
 	return res
 }
-
-func validateHTMLContentTypeHeader(resp *http.Response, contentType string) bool {
-	header := resp.Header.Get("Content-Type")
-
-	return strings.Contains(strings.ToLower(header), contentType)
-}
-
-func validateBodyContentType(body []byte, contentType string) bool {
-	return strings.HasPrefix(http.DetectContentType(body), contentType)
-}
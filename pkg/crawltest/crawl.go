@@ -0,0 +1,76 @@
+package crawltest
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	frontier "github.com/devraulu/crowlr/pkg"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/crawler"
+	"github.com/devraulu/crowlr/pkg/dnscache"
+	"github.com/devraulu/crowlr/pkg/process"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// UserAgent is the user agent of Config.
+const UserAgent = "crowlr-test"
+
+// Result is what a crawl left behind.
+type Result struct {
+	Stats crawler.CrawlStats
+	Store *storage.MemoryStorage
+}
+
+// Config returns the default config with no politeness delay and with the
+// background pollers, snapshot and page batching turned off, so crawls of a
+// Web finish quickly and pages are stored by the time Crawl returns.
+func Config() *config.Config {
+	cfg := config.Default()
+	cfg.Crawler.UserAgent = UserAgent
+	cfg.Crawler.Workers = 4
+	cfg.Crawler.SnapshotFile = ""
+	cfg.Crawler.CommandPollInterval.Duration = 0
+	cfg.Storage.BatchSize = 0
+	cfg.Politeness.Delay.Duration = 0
+	cfg.Feeds.Enabled = false
+	return cfg
+}
+
+// Crawl crawls the web from seeds with cfg into a MemoryStorage. Seeds may
+// leave out the server's port. It returns when the crawl stops: the frontier
+// is empty, a limit is reached or ctx is done.
+func (w *Web) Crawl(ctx context.Context, cfg *config.Config, seeds ...string) (*Result, error) {
+	resolver := dnscache.New(cfg.Politeness.DNSCacheTTL.Duration)
+	ip, _, err := net.SplitHostPort(w.srv.Listener.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range w.Hosts() {
+		resolver.Pin(host, ip)
+	}
+
+	f, err := frontier.NewFromConfig(cfg, resolver, false)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	n := process.NewNormalizer(cfg.Normalize)
+	for _, seed := range seeds {
+		normalized, err := n.Normalize(w.URL(seed))
+		if err != nil {
+			return nil, fmt.Errorf("seed %s: %w", seed, err)
+		}
+		f.Push(frontier.Candidate{Original: seed, Normalized: normalized})
+	}
+
+	store := storage.NewMemoryStorage()
+	c, err := crawler.New(cfg, f, store, crawler.WithResolver(resolver))
+	if err != nil {
+		return nil, err
+	}
+	c.Start(ctx)
+
+	return &Result{Stats: c.CurrentStats(), Store: store}, nil
+}
@@ -0,0 +1,285 @@
+package crawltest_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/crawltest"
+)
+
+func crawl(t *testing.T, web *crawltest.Web, cfg *config.Config, seeds ...string) *crawltest.Result {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := web.Crawl(ctx, cfg, seeds...)
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("crawl timed out")
+	}
+	return res
+}
+
+// pageFetches counts the requests to host, leaving out robots.txt.
+func pageFetches(web *crawltest.Web, host string) int {
+	n := 0
+	for _, r := range web.Requests() {
+		if r.Host == host && r.Path != "/robots.txt" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRobots(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	web.Site("a.test").
+		Robots("User-agent: *\nDisallow: /private/\n").
+		Page("/", "Home", "Welcome", "/public", "/private/secret").
+		Page("/public", "Public", "Anyone may read this").
+		Page("/private/secret", "Secret", "Nobody should read this")
+
+	res := crawl(t, web, crawltest.Config(), "http://a.test/")
+
+	if n := web.Fetches("http://a.test/private/secret"); n != 0 {
+		t.Errorf("disallowed page fetched %d times", n)
+	}
+	if n := web.Fetches("http://a.test/public"); n != 1 {
+		t.Errorf("allowed page fetched %d times, want 1", n)
+	}
+	if n := web.Fetches("http://a.test/robots.txt"); n != 1 {
+		t.Errorf("robots.txt fetched %d times, want 1", n)
+	}
+	if n := len(res.Store.Pages()); n != 2 {
+		t.Errorf("stored %d pages, want 2", n)
+	}
+
+	for _, r := range web.Requests() {
+		if r.Path != "/robots.txt" && r.UserAgent != crawltest.UserAgent {
+			t.Errorf("%s requested with user agent %q, want %q", r.Path, r.UserAgent, crawltest.UserAgent)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	// every page links to every other, and to variants of them that
+	// normalize to the same URL
+	paths := []string{"/", "/a", "/b", "/c"}
+	for _, p := range paths {
+		links := []string{"/", "/a", "/b", "/c", "/a#top", "/b?utm_source=feed", "http://A.TEST/c"}
+		web.Site("a.test").Page(p, "Page "+p, "Linked from everywhere", links...)
+	}
+
+	res := crawl(t, web, crawltest.Config(), "http://a.test/", "http://a.test/index.html")
+
+	for _, p := range paths {
+		if n := web.Fetches("http://a.test" + p); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", p, n)
+		}
+	}
+	if n := pageFetches(web, "a.test"); n != len(paths) {
+		t.Errorf("%d page requests, want %d", n, len(paths))
+	}
+	if n := len(res.Store.Pages()); n != len(paths) {
+		t.Errorf("stored %d pages, want %d", n, len(paths))
+	}
+}
+
+func TestCrawlLimit(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	site := web.Site("a.test")
+	var links []string
+	for i := range 20 {
+		p := fmt.Sprintf("/p%d", i)
+		links = append(links, p)
+		site.Page(p, "Page", "Content")
+	}
+	site.Page("/", "Home", "Index", links...)
+
+	cfg := crawltest.Config()
+	cfg.Crawler.Workers = 1
+	cfg.Crawler.CrawlLimit = 5
+
+	res := crawl(t, web, cfg, "http://a.test/")
+
+	// pages in flight when the limit is hit still finish: the one being
+	// fetched and the one queued for the worker
+	const most = 5 + 1
+	if n := res.Stats.PagesProcessed; n < 5 || n > most {
+		t.Errorf("processed %d pages, want 5 to %d", n, most)
+	}
+	if n := len(res.Store.Pages()); n != res.Stats.PagesProcessed {
+		t.Errorf("stored %d pages, want %d", n, res.Stats.PagesProcessed)
+	}
+	if n := pageFetches(web, "a.test"); n != res.Stats.PagesProcessed {
+		t.Errorf("fetched %d pages, want %d", n, res.Stats.PagesProcessed)
+	}
+	if !strings.Contains(res.Stats.StopReason, "crawl_limit") {
+		t.Errorf("stop reason %q, want crawl_limit", res.Stats.StopReason)
+	}
+}
+
+func TestHostBudget(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	big := web.Site("big.test")
+	var links []string
+	for i := range 10 {
+		p := fmt.Sprintf("/p%d", i)
+		links = append(links, p)
+		big.Page(p, "Page", "Content")
+	}
+	big.Page("/", "Big", "A large site", append(links, "http://small.test/")...)
+	web.Site("small.test").
+		Page("/", "Small", "A small site", "/about").
+		Page("/about", "About", "About the small site")
+
+	cfg := crawltest.Config()
+	cfg.Crawler.Workers = 1
+	cfg.Budget.MaxPagesPerHost = 3
+
+	res := crawl(t, web, cfg, "http://big.test/")
+
+	// like the crawl limit, a page already queued for the worker when the
+	// host is cut off still finishes
+	if n := pageFetches(web, "big.test"); n < 3 || n > 3+1 {
+		t.Errorf("big.test fetched %d times, want its budget of 3 and at most one more", n)
+	}
+	if n := pageFetches(web, "small.test"); n != 2 {
+		t.Errorf("small.test fetched %d times, want 2", n)
+	}
+	if res.Stats.StopReason != "" {
+		t.Errorf("crawl stopped by %q, want it to run out of URLs", res.Stats.StopReason)
+	}
+
+	stats, err := res.Store.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Cutoffs) != 1 || stats.Cutoffs[0].Host != "big.test" || stats.Cutoffs[0].Pages != 3 {
+		t.Errorf("cutoffs %+v, want big.test after 3 pages", stats.Cutoffs)
+	}
+}
+
+func TestPoliteness(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	for _, host := range []string{"a.test", "b.test"} {
+		web.Site(host).
+			Page("/", "Home", "Index", "/1", "/2", "/3").
+			Page("/1", "One", "First").
+			Page("/2", "Two", "Second").
+			Page("/3", "Three", "Third")
+	}
+
+	const delay = 100 * time.Millisecond
+	cfg := crawltest.Config()
+	cfg.Politeness.Delay.Duration = delay
+
+	start := time.Now()
+	crawl(t, web, cfg, "http://a.test/", "http://b.test/")
+	elapsed := time.Since(start)
+
+	for _, host := range []string{"a.test", "b.test"} {
+		gaps := web.Gaps(host)
+		if len(gaps) != 3 {
+			t.Fatalf("%s: %d gaps, want 3", host, len(gaps))
+		}
+		for i, gap := range gaps {
+			// a gap can only come out shorter than the delay by the time
+			// spent fetching robots.txt, which is counted in the first one
+			if gap < delay*8/10 {
+				t.Errorf("%s: gap %d is %s, want at least %s", host, i, gap, delay)
+			}
+		}
+	}
+
+	// both hosts are crawled side by side, not one after the other
+	if elapsed > 6*delay {
+		t.Errorf("crawl took %s, want hosts crawled in parallel", elapsed)
+	}
+}
+
+func TestTrapQuarantine(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	web.Site("a.test").
+		Page("/", "Home", "Index", "/about", "/calendar/1").
+		Page("/about", "About", "About us").
+		Trap("/calendar/")
+
+	cfg := crawltest.Config()
+	cfg.Traps.MaxURLsPerPattern = 5
+
+	res := crawl(t, web, cfg, "http://a.test/")
+
+	calendar := 0
+	for _, r := range web.Requests() {
+		if strings.HasPrefix(r.Path, "/calendar/") {
+			calendar++
+		}
+	}
+	if calendar != 5 {
+		t.Errorf("fetched %d calendar pages, want the limit of 5", calendar)
+	}
+	if n := web.Fetches("http://a.test/about"); n != 1 {
+		t.Errorf("/about fetched %d times, want 1", n)
+	}
+
+	qs, err := res.Store.Quarantines(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qs) != 1 {
+		t.Fatalf("%d quarantined patterns, want 1: %+v", len(qs), qs)
+	}
+	if q := qs[0]; q.Host != "a.test" || q.Pattern != "/calendar/N" || q.URLs != 5 {
+		t.Errorf("quarantined %+v, want /calendar/N of a.test after 5 urls", q)
+	}
+}
+
+func TestTrapSingleURL(t *testing.T) {
+	web := crawltest.NewWeb()
+	defer web.Close()
+
+	long := "/search?q=" + strings.Repeat("x", 600)
+	web.Site("a.test").
+		Page("/", "Home", "Index", long, "/search?q=go", "/search?q=rust").
+		Page("/search", "Search", "Results")
+
+	res := crawl(t, web, crawltest.Config(), "http://a.test/")
+
+	for _, q := range []string{"go", "rust"} {
+		if n := web.Fetches("http://a.test/search?q=" + q); n != 1 {
+			t.Errorf("search for %s fetched %d times, want 1", q, n)
+		}
+	}
+	if n := web.Fetches("http://a.test" + long); n != 0 {
+		t.Errorf("overlong search fetched %d times, want 0", n)
+	}
+
+	qs, err := res.Store.Quarantines(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qs) != 0 {
+		t.Errorf("quarantined %+v, want an overlong url to be skipped on its own", qs)
+	}
+}
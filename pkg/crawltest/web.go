@@ -0,0 +1,298 @@
+// Package crawltest serves synthetic websites from an httptest server and
+// crawls them into memory, so crawler behaviour such as politeness, limits,
+// robots.txt and dedupe can be checked end to end in go test without network
+// access or a database:
+//
+//	web := crawltest.NewWeb()
+//	defer web.Close()
+//	web.Site("a.test").
+//		Robots("User-agent: *\nDisallow: /private/").
+//		Page("/", "Home", "Welcome", "/about", "http://b.test/").
+//		Page("/about", "About", "About us")
+//	web.Site("b.test").Latency(50 * time.Millisecond).Trap("/calendar/")
+//
+//	res, err := web.Crawl(ctx, crawltest.Config(), "http://a.test/")
+//
+// Every site has its own hostname; they are all served by the same server,
+// which crawls made with Web.Crawl resolve them to.
+package crawltest
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request is a request the web received.
+type Request struct {
+	Host string
+	// Path includes the query, if any
+	Path      string
+	UserAgent string
+	Time      time.Time
+}
+
+// Web is a set of sites served by one httptest server.
+type Web struct {
+	srv  *httptest.Server
+	port string
+
+	mu       sync.Mutex
+	sites    map[string]*Site
+	requests []Request
+}
+
+// NewWeb starts a server with no sites. Close it when done.
+func NewWeb() *Web {
+	w := &Web{sites: make(map[string]*Site)}
+	w.srv = httptest.NewServer(http.HandlerFunc(w.serve))
+	_, w.port, _ = net.SplitHostPort(w.srv.Listener.Addr().String())
+	return w
+}
+
+func (w *Web) Close() {
+	w.srv.Close()
+}
+
+// Site returns the site served under host, adding it if it's new.
+func (w *Web) Site(host string) *Site {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	host = strings.ToLower(host)
+	s, ok := w.sites[host]
+	if !ok {
+		s = &Site{web: w, Host: host, routes: make(map[string]http.Handler)}
+		w.sites[host] = s
+	}
+	return s
+}
+
+// Hosts returns the hostnames of the sites.
+func (w *Web) Hosts() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	hosts := make([]string, 0, len(w.sites))
+	for h := range w.sites {
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// URL adds the server's port to rawURL when it points to one of the sites
+// without a port, as in http://a.test/page. Other URLs are returned as they
+// are.
+func (w *Web) URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || u.Port() != "" {
+		return rawURL
+	}
+
+	w.mu.Lock()
+	_, ok := w.sites[strings.ToLower(u.Hostname())]
+	w.mu.Unlock()
+	if !ok {
+		return rawURL
+	}
+
+	u.Host = net.JoinHostPort(u.Hostname(), w.port)
+	return u.String()
+}
+
+// Requests returns every request received so far, in order.
+func (w *Web) Requests() []Request {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Request(nil), w.requests...)
+}
+
+// Fetches returns how many times rawURL was requested. The port may be left
+// out.
+func (w *Web) Fetches(rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	path := u.RequestURI()
+
+	n := 0
+	for _, r := range w.Requests() {
+		if r.Host == strings.ToLower(u.Hostname()) && r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// Gaps returns the time between the arrival of consecutive requests to
+// host, leaving out robots.txt. The crawler's delay runs from when a URL is
+// dispatched, so a slow robots.txt or redirects followed within one fetch
+// can make a gap shorter than the delay.
+func (w *Web) Gaps(host string) []time.Duration {
+	var gaps []time.Duration
+	var last time.Time
+	for _, r := range w.Requests() {
+		if r.Host != host || r.Path == "/robots.txt" {
+			continue
+		}
+		if !last.IsZero() {
+			gaps = append(gaps, r.Time.Sub(last))
+		}
+		last = r.Time
+	}
+	return gaps
+}
+
+func (w *Web) serve(rw http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	host = strings.ToLower(host)
+
+	w.mu.Lock()
+	w.requests = append(w.requests, Request{
+		Host:      host,
+		Path:      r.URL.RequestURI(),
+		UserAgent: r.UserAgent(),
+		Time:      time.Now(),
+	})
+	site, ok := w.sites[host]
+	w.mu.Unlock()
+
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+	site.serve(rw, r)
+}
+
+// Site is one host of a Web. Its methods return the site so calls can be
+// chained. Configure sites before crawling them.
+type Site struct {
+	web  *Web
+	Host string
+
+	mu      sync.Mutex
+	routes  map[string]http.Handler
+	robots  *string
+	latency time.Duration
+	traps   []string
+}
+
+// Page serves an HTML page at path with the given title, body text and
+// links. Links to sites of the web get the server's port.
+func (s *Site) Page(path, title, body string, links ...string) *Site {
+	return s.Handle(path, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(rw, "<!DOCTYPE html>\n<html lang=\"en\"><head><title>%s</title></head><body>\n<h1>%s</h1>\n<p>%s</p>\n",
+			html.EscapeString(title), html.EscapeString(title), html.EscapeString(body))
+		// resolved when served, so links may point to sites added later
+		for _, link := range links {
+			fmt.Fprintf(rw, "<a href=\"%s\">%s</a>\n", html.EscapeString(s.web.URL(link)), html.EscapeString(link))
+		}
+		fmt.Fprint(rw, "</body></html>\n")
+	}))
+}
+
+// Redirect redirects path to to with code, e.g. http.StatusMovedPermanently.
+func (s *Site) Redirect(path, to string, code int) *Site {
+	return s.Handle(path, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.Redirect(rw, r, s.web.URL(to), code)
+	}))
+}
+
+// Status answers path with code and a short HTML body.
+func (s *Site) Status(path string, code int) *Site {
+	return s.Handle(path, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.WriteHeader(code)
+		fmt.Fprintf(rw, "<html><body><p>%s</p></body></html>\n", http.StatusText(code))
+	}))
+}
+
+// Robots serves txt as the site's robots.txt. Without it, robots.txt is a
+// 404 and everything may be crawled.
+func (s *Site) Robots(txt string) *Site {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.robots = &txt
+	return s
+}
+
+// Latency delays every response of the site by d, making it a slow host.
+func (s *Site) Latency(d time.Duration) *Site {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+	return s
+}
+
+// Trap serves an endless chain of pages under prefix: prefix+"1" links to
+// prefix+"2" and so on, like a calendar with a "next month" link.
+func (s *Site) Trap(prefix string) *Site {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.traps = append(s.traps, prefix)
+	return s
+}
+
+// Handle serves path with h.
+func (s *Site) Handle(path string, h http.Handler) *Site {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes[path] = h
+	return s
+}
+
+func (s *Site) serve(rw http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency, robots := s.latency, s.robots
+	h, ok := s.routes[r.URL.Path]
+	traps := s.traps
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if r.URL.Path == "/robots.txt" && robots != nil {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(rw, *robots)
+		return
+	}
+	if ok {
+		h.ServeHTTP(rw, r)
+		return
+	}
+	for _, prefix := range traps {
+		if rest, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+			s.serveTrap(rw, prefix, rest)
+			return
+		}
+	}
+	http.NotFound(rw, r)
+}
+
+func (s *Site) serveTrap(rw http.ResponseWriter, prefix, rest string) {
+	n, err := strconv.Atoi(rest)
+	if err != nil || n < 0 {
+		n = 0
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(rw, "<html lang=\"en\"><head><title>Page %d</title></head><body><p>Entry %d</p><a href=\"%s%d\">next</a></body></html>\n",
+		n, n, prefix, n+1)
+}
@@ -0,0 +1,125 @@
+// Package dnscache caches DNS lookups so that the frontier's politeness
+// groups and the crawler's connections agree on a host's address.
+package dnscache
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Failed lookups are cached for a fraction of the TTL so a broken name is not
+// resolved on every link to it.
+const negativeTTLDivisor = 10
+
+type entry struct {
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+type Resolver struct {
+	ttl      time.Duration
+	resolver *net.Resolver
+	dialer   *net.Dialer
+
+	mu      sync.Mutex
+	entries map[string]entry
+	// pinned addresses never expire, like /etc/hosts entries
+	pinned map[string][]string
+}
+
+func New(ttl time.Duration) *Resolver {
+	return &Resolver{
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+		dialer:   &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries:  make(map[string]entry),
+		pinned:   make(map[string][]string),
+	}
+}
+
+// Pin makes host resolve to addrs without DNS lookups, e.g. to point test
+// hostnames at a local server.
+func (r *Resolver) Pin(host string, addrs ...string) {
+	r.mu.Lock()
+	r.pinned[host] = addrs
+	r.mu.Unlock()
+}
+
+// LookupHost returns the addresses of host, from the cache while they are
+// fresh. IP literals are returned as they are.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []string{ip.String()}, nil
+	}
+
+	r.mu.Lock()
+	pinned, isPinned := r.pinned[host]
+	e, ok := r.entries[host]
+	r.mu.Unlock()
+	if isPinned {
+		return pinned, nil
+	}
+	if ok && time.Now().Before(e.expires) {
+		return e.addrs, e.err
+	}
+
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil && ctx.Err() != nil {
+		// don't cache a lookup cut short by the caller
+		return nil, err
+	}
+
+	ttl := r.ttl
+	if err != nil {
+		ttl /= negativeTTLDivisor
+	}
+
+	r.mu.Lock()
+	r.entries[host] = entry{addrs: addrs, err: err, expires: time.Now().Add(ttl)}
+	r.mu.Unlock()
+
+	return addrs, err
+}
+
+// LookupIP returns the first cached address of host, which is the one
+// DialContext tries first.
+func (r *Resolver) LookupIP(ctx context.Context, host string) (string, error) {
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if len(addrs) == 0 {
+		return "", &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	return addrs[0], nil
+}
+
+// DialContext dials addr through the cache, trying each address in turn. It
+// can be used as http.Transport.DialContext.
+func (r *Resolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, a := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	return nil, lastErr
+}
@@ -1,126 +1,419 @@
 package frontier
 
 import (
+	"container/heap"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	netUrl "net/url"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/devraulu/crowlr/pkg/clock"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/dnscache"
 )
 
 type Candidate struct {
 	Original   string
 	Normalized string
 	Referrer   string
+	// Depth is the number of links followed from a seed.
+	Depth int
+	// Priority is an optional hint between 0 and 1, such as a sitemap
+	// <priority>. Zero means none was given.
+	Priority float64
+	// Inlinks counts how many times the URL was discovered while queued.
+	Inlinks int
+	// Seed holds the options of the seed the URL was reached from, nil if
+	// it has none.
+	Seed *SeedOptions
+	// Group is the politeness group the URL is queued in. The frontier
+	// sets it when the URL is first queued and uses it from then on; it may
+	// be set beforehand, off the caller's hot path, as it can take a DNS
+	// lookup.
+	Group string
 }
 
-type HostQueue struct {
-	Host      string
-	URLs      []string
-	NextVisit time.Time
+// Queue is what the crawler needs from a frontier. Frontier is the
+// in-process implementation; cluster.Frontier shares one queue between
+// crawler processes.
+type Queue interface {
+	// Push queues c and reports whether the URL was new.
+	Push(c Candidate) bool
+	// PushFront queues c ahead of everything else waiting for its host.
+	PushFront(c Candidate) bool
+	// Pop returns the next candidate that may be fetched, or nil and how
+	// long to wait before asking again.
+	Pop(defaultDelay time.Duration) (*Candidate, time.Duration)
+	// Done marks a popped candidate as finished.
+	Done(url string)
+	// Requeue puts back a popped candidate that was never fetched.
+	Requeue(c Candidate)
+	// Reserve takes the next visit of rawURL's politeness group for a fetch
+	// made outside Pop, such as a feed poll. When the group is due it is
+	// pushed back by the group's delay and 0 is returned, and the fetch
+	// ends with Report and Done like a popped URL. Otherwise Reserve
+	// returns how long until the group is due.
+	Reserve(rawURL string, defaultDelay time.Duration) (time.Duration, error)
+	// Report records how fetching url went, for adaptive throttling: how
+	// long the response took and its status code, 0 if there was none. It
+	// is called before Done.
+	Report(url string, latency time.Duration, statusCode int)
+	// Len returns how many URLs are queued or in flight.
+	Len() (int, error)
+	Close() error
 }
 
-type SeenRecord struct {
-	OriginalURL string
-	Referrer    string
+// Option configures a Frontier.
+type Option func(*Frontier)
+
+// WithScorer sets the scorer that orders each host's queue. The default
+// crawls shallow URLs first.
+func WithScorer(s Scorer) Option {
+	return func(f *Frontier) {
+		f.scorer = s
+	}
+}
+
+// WithThrottle adapts each host's delay to its response times and errors
+// instead of always using the default delay.
+func WithThrottle(t *Throttle) Option {
+	return func(f *Frontier) {
+		f.throttle = t
+	}
+}
+
+// WithClock sets the clock that politeness delays are timed with. The
+// default is the system clock.
+func WithClock(c clock.Clock) Option {
+	return func(f *Frontier) {
+		f.clock = c
+	}
+}
+
+// WithSeenSet sets where accepted URLs are remembered. The default keeps
+// them all in memory.
+func WithSeenSet(s SeenSet) Option {
+	return func(f *Frontier) {
+		f.seen = s
+	}
 }
 
 type Frontier struct {
 	mu     sync.Mutex
-	queues map[string]*HostQueue
-	seen   map[string]SeenRecord
+	scorer Scorer
+	key    KeyFunc
+	clock  clock.Clock
+	// throttle adapts each host's delay when set, starting from the
+	// default delay last passed to Pop
+	throttle     *Throttle
+	defaultDelay time.Duration
+	queues       map[string]*HostQueue
+	// hosts holds the non-empty queues ordered by NextVisit
+	hosts hostHeap
+	// queued indexes the queued items, which carry each URL's metadata
+	queued map[string]*item
+	// inflight maps popped URLs to their group until they are done
+	inflight map[string]string
+	seen     SeenSet
+	spill    *spill
+	count    int
+	seq      uint64
 }
 
-func NewFrontier() *Frontier {
-	return &Frontier{
-		queues: make(map[string]*HostQueue),
-		seen:   make(map[string]SeenRecord),
+func NewFrontier(opts ...Option) *Frontier {
+	f := &Frontier{
+		scorer:   DepthScorer{},
+		key:      HostKey,
+		clock:    clock.Real,
+		queues:   make(map[string]*HostQueue),
+		queued:   make(map[string]*item),
+		inflight: make(map[string]string),
+		seen:     NewMemorySeenSet(),
+	}
+	for _, opt := range opts {
+		opt(f)
 	}
+	return f
 }
 
-func (f *Frontier) Push(normalizedURL, originalURL, referrer string) {
+// NewFromConfig builds the in-process frontier described by cfg: its
+// scorer, seen-set, politeness groups (resolved through resolver when
+// grouped by address), adaptive throttling and queue spilling. With resume
+// set, a disk seen-set keeps the URLs of the crawl being resumed. opts are
+// applied after those from cfg.
+func NewFromConfig(cfg *config.Config, resolver *dnscache.Resolver, resume bool, opts ...Option) (*Frontier, error) {
+	scorer, err := NewScorer(cfg.Frontier)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frontier config: %w", err)
+	}
+
+	key, err := NewKeyFunc(cfg.Politeness.Group, resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	seen, err := NewSeenSet(cfg.Frontier.Seen, resume)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open seen-set: %w", err)
+	}
+
+	base := []Option{WithScorer(scorer), WithSeenSet(seen), WithPolitenessKey(key)}
+	if throttle := NewThrottle(cfg.Politeness); throttle != nil {
+		base = append(base, WithThrottle(throttle))
+	}
+	if q := cfg.Frontier.Queue; q.MemoryLimit > 0 {
+		base = append(base, WithSpill(q.SpillDir, q.MemoryLimit, q.SegmentSize))
+	}
+
+	return NewFrontier(append(base, opts...)...), nil
+}
+
+// Push queues c for its host and reports whether the URL was new. A URL that
+// is already queued gains an inlink and is rescored instead.
+func (f *Frontier) Push(c Candidate) bool {
+	return f.push(c, false)
+}
+
+// PushFront queues c ahead of everything else waiting for its host, for
+// fresh content such as new feed entries. It reports whether the URL was new.
+func (f *Frontier) PushFront(c Candidate) bool {
+	return f.push(c, true)
+}
+
+func (f *Frontier) push(c Candidate, front bool) bool {
+	if c.Group == "" {
+		// resolved before locking, as it may need a DNS lookup
+		group, err := f.key.Group(c.Normalized)
+		if err != nil {
+			slog.Error("frontier bad url", slog.String("url", c.Normalized), slog.Any("err", err))
+			return false
+		}
+		c.Group = group
+	}
+	host := c.Group
+
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if _, ok := f.seen[normalizedURL]; ok {
-		slog.Info("frontier duplicate, skipping", slog.String("url", normalizedURL), slog.String("original_url", originalURL))
-		return
+	if it, ok := f.queued[c.Normalized]; ok {
+		it.Inlinks++
+		if !it.front {
+			it.score = f.scorer.Score(it.Candidate)
+			heap.Fix(&f.queues[it.host].items, it.index)
+		}
+		slog.Info("frontier duplicate, skipping", slog.String("url", c.Normalized), slog.String("original_url", c.Original))
+		return false
 	}
 
-	host, err := getHost(normalizedURL)
+	added, err := f.seen.Add(c.Normalized)
 	if err != nil {
-		slog.Error("frontier bad url", slog.String("url", normalizedURL), slog.Any("err", err))
-		return
+		slog.Error("frontier seen-set failed", slog.String("url", c.Normalized), slog.Any("err", err))
+		return false
 	}
-
-	f.seen[normalizedURL] = SeenRecord{
-		OriginalURL: originalURL,
-		Referrer:    referrer,
+	if !added {
+		slog.Info("frontier duplicate, skipping", slog.String("url", c.Normalized), slog.String("original_url", c.Original))
+		return false
 	}
 
+	it := f.add(host, c, front)
+	slog.Debug("frontier push", slog.String("host", host), slog.String("url", c.Normalized), slog.Float64("score", it.score), slog.Int("queue_len", f.queues[host].Len()))
+	return true
+}
+
+// add queues c for host. The caller holds f.mu.
+func (f *Frontier) add(host string, c Candidate, front bool) *item {
 	hq, ok := f.queues[host]
 	if !ok {
 		hq = &HostQueue{
-			Host: host,
+			Host:  host,
+			index: -1,
 		}
 		f.queues[host] = hq
 	}
+	if c.Seed != nil && c.Seed.Delay > 0 && hq.SeedDelay == 0 {
+		hq.SeedDelay = c.Seed.Delay
+	}
+
+	it := &item{
+		Candidate: c,
+		host:      host,
+		front:     front,
+		seq:       f.seq,
+	}
+	f.seq++
+	if front {
+		it.score = math.Inf(1)
+	} else {
+		it.score = f.scorer.Score(c)
+	}
+
+	f.enqueue(hq, it)
+	f.count++
 
-	hq.URLs = append(hq.URLs, normalizedURL)
-	slog.Debug("frontier push", slog.String("host", host), slog.String("url", normalizedURL), slog.Int("queue_len", len(hq.URLs)))
+	if hq.index < 0 {
+		heap.Push(&f.hosts, hq)
+	}
+	return it
 }
 
+// Pop returns the best candidate of the host whose next visit is due
+// soonest. If that host is still waiting out its delay, Pop returns nil and
+// how long until it is ready.
 func (f *Frontier) Pop(defaultDelay time.Duration) (*Candidate, time.Duration) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if len(f.queues) == 0 {
-		return nil, 0
-	}
+	f.defaultDelay = defaultDelay
 
-	now := time.Now()
-	var minWait time.Duration = -1
+	now := f.clock.Now()
+	for f.hosts.Len() > 0 {
+		hq := f.hosts[0]
+		if wait := hq.NextVisit.Sub(now); wait > 0 {
+			return nil, wait
+		}
 
-	for host, hq := range f.queues {
-		if len(hq.URLs) == 0 {
-			delete(f.queues, host)
+		it := f.dequeue(hq)
+		if it == nil {
+			heap.Remove(&f.hosts, hq.index)
 			continue
 		}
+		f.count--
 
-		if now.After(hq.NextVisit) {
-			// found a ready host!
-			url := hq.URLs[0]
-			hq.URLs = hq.URLs[1:]
-			hq.NextVisit = now.Add(defaultDelay)
-
-			slog.Info("next candidate", slog.String("host", host), slog.String("url", url))
-			seen := f.seen[url]
-			referrer := seen.Referrer
-
-			return &Candidate{
-				Original:   seen.OriginalURL,
-				Normalized: url,
-				Referrer:   referrer,
-			}, 0
+		hq.NextVisit = now.Add(hq.delay(defaultDelay))
+		if hq.Len() == 0 {
+			// the queue stays in f.queues so its NextVisit is kept
+			heap.Remove(&f.hosts, hq.index)
+		} else {
+			heap.Fix(&f.hosts, hq.index)
 		}
 
-		wait := hq.NextVisit.Sub(now)
-		if minWait == -1 || wait < minWait {
-			minWait = wait
+		slog.Info("next candidate", slog.String("host", hq.Host), slog.String("url", it.Normalized), slog.Float64("score", it.score))
+		f.inflight[it.Normalized] = it.Group
+		c := it.Candidate
+		return &c, 0
+	}
+
+	return nil, 0
+}
+
+// Done forgets the group of a popped URL, which left the queue when popped.
+func (f *Frontier) Done(url string) {
+	f.mu.Lock()
+	delete(f.inflight, url)
+	f.mu.Unlock()
+}
+
+// Requeue puts c back at the front of its group's queue. It bypasses the
+// seen-set, which already holds the URL.
+func (f *Frontier) Requeue(c Candidate) {
+	if c.Group == "" {
+		group, err := f.key.Group(c.Normalized)
+		if err != nil {
+			return
+		}
+		c.Group = group
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.inflight, c.Normalized)
+	if _, ok := f.queued[c.Normalized]; ok {
+		return
+	}
+	f.add(c.Group, c, true)
+}
+
+// Reserve takes the next visit of rawURL's group when it is due, and tracks
+// rawURL as in flight so Report can adjust the group's delay.
+func (f *Frontier) Reserve(rawURL string, defaultDelay time.Duration) (time.Duration, error) {
+	group, err := f.key.Group(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	hq, ok := f.queues[group]
+	if !ok {
+		hq = &HostQueue{
+			Host:  group,
+			index: -1,
 		}
+		f.queues[group] = hq
 	}
 
-	return nil, minWait
+	now := f.clock.Now()
+	if wait := hq.NextVisit.Sub(now); wait > 0 {
+		return wait, nil
+	}
+
+	hq.NextVisit = now.Add(hq.delay(defaultDelay))
+	if hq.index >= 0 {
+		heap.Fix(&f.hosts, hq.index)
+	}
+	f.inflight[rawURL] = group
+	return 0, nil
+}
+
+// Report adjusts the delay of url's host when throttling is enabled. A
+// longer delay also pushes back the host's next visit.
+func (f *Frontier) Report(url string, latency time.Duration, statusCode int) {
+	if f.throttle == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// the group the URL was popped from, even if its key changed since
+	host, ok := f.inflight[url]
+	if !ok {
+		return
+	}
+	hq, ok := f.queues[host]
+	if !ok {
+		return
+	}
+
+	prev := hq.delay(f.defaultDelay)
+	hq.Stats = f.throttle.Update(hq.Stats, hq.baseDelay(f.defaultDelay), latency, statusCode)
+	// a seed delay is a floor the throttle may not go below
+	hq.Stats.Delay = max(hq.Stats.Delay, hq.SeedDelay)
+	if hq.Stats.Delay > prev {
+		if next := f.clock.Now().Add(hq.Stats.Delay); next.After(hq.NextVisit) {
+			hq.NextVisit = next
+			if hq.index >= 0 {
+				heap.Fix(&f.hosts, hq.index)
+			}
+		}
+	}
+
+	slog.Debug("frontier throttle", slog.String("host", host), slog.Int("status", statusCode), slog.Duration("latency", hq.Stats.Latency),
+		slog.Float64("error_rate", hq.Stats.ErrorRate), slog.Duration("delay", hq.Stats.Delay))
 }
 
-func (f *Frontier) Len() int {
+// Len returns how many URLs are queued or were popped or reserved and aren't
+// done yet.
+func (f *Frontier) Len() (int, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	count := 0
-	for _, hq := range f.queues {
-		count += len(hq.URLs)
+	return f.count + len(f.inflight), nil
+}
+
+// Close releases the seen-set and removes any spilled queue segments.
+func (f *Frontier) Close() error {
+	var errs []error
+	if f.spill != nil {
+		errs = append(errs, f.spill.close())
 	}
-	return count
+	errs = append(errs, f.seen.Close())
+	return errors.Join(errs...)
 }
 
 func getHost(str string) (string, error) {
@@ -0,0 +1,153 @@
+// Package lang detects the language of a text and normalizes language tags
+// to ISO 639-1 codes.
+package lang
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxWords caps how much of a long document is looked at.
+const maxWords = 2000
+
+// Detection needs a minimum weighted score, and the winner must beat the
+// runner-up by a margin, before a Latin-script language is reported.
+const (
+	minScore  = 1.5
+	minMargin = 1.25
+)
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "for", "was", "on", "are", "with", "as", "this", "be", "at", "by", "from", "have", "not", "or", "which", "you", "but", "they", "his", "her", "we", "an", "what", "how", "why", "when"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "del", "se", "las", "por", "un", "para", "con", "no", "una", "su", "al", "es", "lo", "como", "más", "pero", "sus", "le", "ya", "este", "porque", "esta", "entre", "cuando", "muy", "sin", "sobre", "también", "cómo", "qué"},
+	"fr": {"le", "la", "les", "de", "des", "et", "en", "un", "une", "du", "est", "que", "qui", "dans", "pour", "pas", "sur", "au", "avec", "ce", "il", "sont", "par", "plus", "ne", "se", "aux", "mais", "nous", "vous", "cette", "ont", "comment", "pourquoi"},
+	"de": {"der", "die", "und", "in", "den", "von", "zu", "das", "mit", "sich", "des", "auf", "für", "ist", "im", "dem", "nicht", "ein", "eine", "als", "auch", "es", "an", "werden", "aus", "er", "hat", "dass", "sie", "nach", "wird", "bei", "einer", "um", "noch", "wie", "über", "warum"},
+	"it": {"il", "di", "che", "e", "la", "in", "un", "per", "non", "una", "sono", "del", "della", "le", "si", "con", "gli", "da", "al", "dei", "nel", "alla", "più", "anche", "come", "ma", "questo", "è", "delle", "ha", "perché"},
+	"pt": {"de", "que", "e", "o", "do", "da", "em", "um", "para", "é", "com", "não", "uma", "os", "no", "se", "na", "por", "mais", "as", "dos", "como", "mas", "ao", "ele", "das", "à", "seu", "sua", "ou", "quando", "muito", "também", "são", "porque"},
+	"nl": {"de", "het", "een", "en", "van", "in", "is", "dat", "op", "te", "zijn", "met", "voor", "niet", "aan", "er", "om", "ook", "als", "bij", "maar", "dan", "worden", "wordt", "deze", "zich", "nog", "uit", "naar", "heeft", "ze", "hij", "hoe", "waarom"},
+	"sv": {"och", "i", "att", "det", "som", "en", "på", "är", "av", "för", "med", "till", "den", "har", "de", "inte", "om", "ett", "han", "men", "var", "jag", "sig", "från", "vi", "så", "kan", "när", "efter", "ska", "hur", "varför"},
+	"da": {"og", "i", "at", "det", "en", "den", "til", "er", "som", "på", "de", "med", "han", "af", "for", "ikke", "der", "var", "mig", "sig", "men", "et", "har", "om", "vi", "min", "havde", "ham", "hun", "nu", "over", "fra", "du", "ud", "kan", "efter", "hvordan", "hvorfor"},
+	"no": {"og", "i", "det", "at", "en", "som", "på", "er", "til", "av", "for", "med", "de", "den", "ikke", "har", "et", "om", "var", "jeg", "men", "så", "seg", "han", "fra", "kan", "vi", "etter", "hun", "også", "eller", "må", "hvordan", "hvorfor"},
+	"fi": {"ja", "on", "ei", "se", "että", "hän", "oli", "ovat", "mutta", "kun", "niin", "myös", "tai", "jos", "joka", "sen", "kuin", "ole", "mitä", "tämä", "vain", "sekä", "jo", "voi", "hänen", "miten", "miksi"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "olarak", "daha", "gibi", "ne", "var", "en", "ama", "sonra", "kadar", "değil", "olan", "her", "mi", "ya", "şey", "göre", "ise", "nasıl", "neden"},
+	"id": {"yang", "dan", "di", "ini", "itu", "dengan", "untuk", "dari", "dalam", "tidak", "akan", "pada", "juga", "ke", "ada", "adalah", "atau", "oleh", "karena", "kami", "mereka", "sudah", "bisa", "saya", "bagaimana", "mengapa"},
+	"ro": {"și", "de", "la", "în", "cu", "pe", "nu", "care", "din", "a", "o", "să", "un", "este", "ce", "mai", "se", "pentru", "sau", "ca", "sunt", "fost", "prin", "dar", "lui", "după", "cum"},
+	"hu": {"a", "az", "és", "hogy", "nem", "is", "egy", "van", "de", "meg", "ez", "volt", "azt", "csak", "már", "mint", "még", "vagy", "ha", "el", "kell", "lesz", "pedig", "nagyon", "hogyan", "miért"},
+	"ca": {"el", "la", "de", "i", "que", "a", "en", "els", "les", "del", "per", "un", "una", "amb", "no", "és", "al", "com", "més", "però", "seu", "dels", "aquesta", "també", "hi", "ha", "perquè"},
+}
+
+// weights gives every stopword a weight of 1/n, where n is the number of
+// languages that share it, so "de" counts for little and "the" counts fully.
+var weights = buildWeights()
+
+func buildWeights() map[string]map[string]float64 {
+	shared := make(map[string]int)
+	for _, words := range stopwords {
+		seen := make(map[string]bool)
+		for _, w := range words {
+			if !seen[w] {
+				shared[w]++
+				seen[w] = true
+			}
+		}
+	}
+
+	weights := make(map[string]map[string]float64)
+	for code, words := range stopwords {
+		weights[code] = make(map[string]float64)
+		for _, w := range words {
+			weights[code][w] = 1 / float64(shared[w])
+		}
+	}
+	return weights
+}
+
+// scripts maps writing systems that identify a language well enough on their
+// own. Cyrillic is reported as Russian.
+var scripts = []struct {
+	table *unicode.RangeTable
+	code  string
+}{
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Tamil, "ta"},
+	{unicode.Armenian, "hy"},
+}
+
+// Detect returns the ISO 639-1 code of the language text is most likely
+// written in, or "" when it can't tell. Non-Latin scripts are identified by
+// their characters; Latin-script languages by weighted stopword frequency.
+func Detect(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) > maxWords {
+		words = words[:maxWords]
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	if code := detectScript(words); code != "" {
+		return code
+	}
+
+	scores := make(map[string]float64)
+	for _, w := range words {
+		for code, ws := range weights {
+			scores[code] += ws[w]
+		}
+	}
+
+	var best, second float64
+	var bestCode string
+	for code, score := range scores {
+		switch {
+		case score > best:
+			second = best
+			best, bestCode = score, code
+		case score > second:
+			second = score
+		}
+	}
+
+	if best < minScore || best < second*minMargin {
+		return ""
+	}
+	return bestCode
+}
+
+func detectScript(words []string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, w := range words {
+		for _, r := range w {
+			letters++
+			for _, s := range scripts {
+				if unicode.Is(s.table, r) {
+					counts[s.code]++
+					break
+				}
+			}
+		}
+	}
+
+	for code, n := range counts {
+		if n*2 > letters {
+			return code
+		}
+	}
+	return ""
+}
+
+// Base returns the lowercase primary subtag of a language tag, so "en-US"
+// and "en_gb" both become "en".
+func Base(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
@@ -1,21 +1,27 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
 
 	"github.com/devraulu/crowlr/pkg/config"
 )
 
-func InitLogger(cfg *config.Config) {
+func InitLogger(cfg *config.Config, w io.Writer) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "unknown"
 	}
 
+	level, err := cfg.Logging.SlogLevel()
+	if err != nil {
+		level = slog.LevelInfo
+	}
+
 	var handler slog.Handler
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
 		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
 			if a.Key == slog.LevelKey {
 				// Only use bunyan levels if JSON
@@ -29,9 +35,9 @@ func InitLogger(cfg *config.Config) {
 	}
 
 	if cfg.Logging.Format == "text" {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(w, opts)
 	} else {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(w, opts)
 	}
 
 	logger := slog.New(handler).With(
@@ -0,0 +1,82 @@
+package frontier
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/dnscache"
+	"golang.org/x/net/publicsuffix"
+)
+
+// lookupTimeout bounds the DNS lookup behind IPKey.
+const lookupTimeout = 5 * time.Second
+
+// KeyFunc maps a hostname to the politeness group it is rate limited in.
+// Each group has one queue and one politeness delay.
+type KeyFunc func(host string) string
+
+// Group returns the politeness group of rawURL's host.
+func (k KeyFunc) Group(rawURL string) (string, error) {
+	host, err := getHost(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return k(host), nil
+}
+
+// HostKey rate limits every hostname on its own.
+func HostKey(host string) string {
+	return host
+}
+
+// DomainKey groups hostnames by registrable domain, so a.example.co.uk and
+// b.example.co.uk share a delay.
+func DomainKey(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// IPKey groups hostnames by the address they resolve to, so sites on one
+// shared server share a delay. Hosts that fail to resolve are grouped on
+// their own. A URL stays in the group it was queued in even if its host
+// later resolves elsewhere.
+func IPKey(r *dnscache.Resolver) KeyFunc {
+	return func(host string) string {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+
+		ip, err := r.LookupIP(ctx, host)
+		if err != nil {
+			slog.Debug("politeness lookup failed, grouping by host", slog.String("host", host), slog.Any("err", err))
+			return host
+		}
+		return "ip:" + ip
+	}
+}
+
+// NewKeyFunc returns the KeyFunc for a politeness.group setting.
+func NewKeyFunc(group string, r *dnscache.Resolver) (KeyFunc, error) {
+	switch group {
+	case "", "host":
+		return HostKey, nil
+	case "domain":
+		return DomainKey, nil
+	case "ip":
+		return IPKey(r), nil
+	default:
+		return nil, fmt.Errorf("unknown politeness group %q", group)
+	}
+}
+
+// WithPolitenessKey sets how hosts are grouped for politeness. The default
+// groups by hostname.
+func WithPolitenessKey(key KeyFunc) Option {
+	return func(f *Frontier) {
+		f.key = key
+	}
+}
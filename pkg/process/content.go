@@ -0,0 +1,105 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/devraulu/crowlr/pkg/config"
+)
+
+// ContentHandler turns a fetched body of one MIME type into page content
+// before the processor pipeline runs. Markup handlers also set doc.Root so
+// DOM processors can run on it.
+type ContentHandler interface {
+	Handle(ctx context.Context, doc *Document) error
+}
+
+type ContentHandlerFunc func(ctx context.Context, doc *Document) error
+
+func (f ContentHandlerFunc) Handle(ctx context.Context, doc *Document) error {
+	return f(ctx, doc)
+}
+
+var (
+	contentMu       sync.RWMutex
+	contentRegistry = make(map[string]ContentHandler)
+)
+
+// RegisterContentHandler makes a handler available for a MIME type, which
+// can then be enabled through processing.content_types. It panics if the
+// type already has a handler.
+func RegisterContentHandler(mediaType string, h ContentHandler) {
+	contentMu.Lock()
+	defer contentMu.Unlock()
+
+	if h == nil {
+		panic("process: RegisterContentHandler handler is nil")
+	}
+	if _, dup := contentRegistry[mediaType]; dup {
+		panic("process: RegisterContentHandler called twice for " + mediaType)
+	}
+	contentRegistry[mediaType] = h
+}
+
+// ContentHandlers is the set of handlers enabled for a crawl.
+type ContentHandlers struct {
+	types    []string
+	handlers map[string]ContentHandler
+}
+
+func NewContentHandlers(cfg *config.Config) (*ContentHandlers, error) {
+	contentMu.RLock()
+	defer contentMu.RUnlock()
+
+	ch := &ContentHandlers{handlers: make(map[string]ContentHandler)}
+	for _, t := range cfg.Processing.ContentTypes {
+		h, ok := contentRegistry[t]
+		if !ok {
+			return nil, fmt.Errorf("no content handler registered for %q", t)
+		}
+		ch.types = append(ch.types, t)
+		ch.handlers[t] = h
+	}
+
+	return ch, nil
+}
+
+// For returns the handler for a media type, if one is enabled.
+func (ch *ContentHandlers) For(mediaType string) (ContentHandler, bool) {
+	h, ok := ch.handlers[mediaType]
+	return h, ok
+}
+
+// Accept builds an Accept header listing the enabled types in config order,
+// each one ranked slightly below the one before it.
+func (ch *ContentHandlers) Accept() string {
+	parts := make([]string, len(ch.types))
+	for i, t := range ch.types {
+		q := max(1-float64(i)*0.1, 0.1)
+		if i == 0 {
+			parts[i] = t
+			continue
+		}
+		parts[i] = fmt.Sprintf("%s;q=%.1f", t, q)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MediaType returns the lowercase media type of a response, sniffing the
+// body when the server sends none or a generic binary type. With a nil body
+// an unknown type is reported as application/octet-stream.
+func MediaType(resp *http.Response, body []byte) string {
+	header := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" {
+		if body == nil {
+			return "application/octet-stream"
+		}
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	return strings.ToLower(mediaType)
+}
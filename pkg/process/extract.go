@@ -3,6 +3,7 @@ package process
 import (
 	"io"
 	"net/url"
+	"slices"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -10,7 +11,16 @@ import (
 
 type extractionResult struct {
 	Outlinks []string
+	Feeds    []string
 	Title    string
+	Metadata *Metadata
+}
+
+// feedTypes are the <link rel="alternate"> types advertised for feeds.
+var feedTypes = map[string]bool{
+	"application/rss+xml":  true,
+	"application/atom+xml": true,
+	"application/rdf+xml":  true,
 }
 
 func ExtractLinks(body io.Reader, baseURL string) (*extractionResult, error) {
@@ -31,11 +41,14 @@ func ExtractLinks(body io.Reader, baseURL string) (*extractionResult, error) {
 	}
 
 	links := extractAndResolve(doc, base)
+	feeds := findFeeds(doc, base)
 	title := extractTitle(doc)
 
 	return &extractionResult{
 		Outlinks: links,
+		Feeds:    feeds,
 		Title:    title,
+		Metadata: ExtractMetadata(doc),
 	}, nil
 }
 
@@ -55,6 +68,33 @@ func findBase(n *html.Node) string {
 	return ""
 }
 
+func findFeeds(n *html.Node, base *url.URL) []string {
+	var feeds []string
+	if n.Type == html.ElementNode && n.Data == "link" {
+		var rel, typ, href string
+		for _, attr := range n.Attr {
+			switch attr.Key {
+			case "rel":
+				rel = strings.ToLower(attr.Val)
+			case "type":
+				typ = strings.ToLower(strings.TrimSpace(attr.Val))
+			case "href":
+				href = strings.TrimSpace(attr.Val)
+			}
+		}
+		if feedTypes[typ] && href != "" && slices.Contains(strings.Fields(rel), "alternate") {
+			if resolved := resolve(href, base); resolved != "" {
+				feeds = append(feeds, resolved)
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		feeds = append(feeds, findFeeds(c, base)...)
+	}
+	return feeds
+}
+
 func extractAndResolve(n *html.Node, base *url.URL) []string {
 	var links []string
 	if n.Type == html.ElementNode && n.Data == "a" {
@@ -0,0 +1,168 @@
+package process
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var ErrNotFeed = errors.New("not an RSS or Atom feed")
+
+type Feed struct {
+	Title   string
+	Link    string
+	Entries []FeedEntry
+}
+
+type FeedEntry struct {
+	ID        string
+	Title     string
+	Link      string
+	Summary   string
+	Published *time.Time
+}
+
+type rssDoc struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Link  string    `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	// RSS 1.0 (RDF) puts items next to the channel instead of inside it.
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomDoc struct {
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+	Content   string     `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+// ParseFeed reads an RSS 2.0, RSS 1.0 or Atom document. It returns
+// ErrNotFeed for any other XML.
+func ParseFeed(body []byte) (*Feed, error) {
+	root, err := rootElement(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(root) {
+	case "rss", "rdf":
+		var doc rssDoc
+		if err := newXMLDecoder(body).Decode(&doc); err != nil {
+			return nil, err
+		}
+		feed := &Feed{Title: strings.TrimSpace(doc.Channel.Title), Link: strings.TrimSpace(doc.Channel.Link)}
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			entry := FeedEntry{
+				ID:      strings.TrimSpace(item.GUID),
+				Title:   strings.TrimSpace(item.Title),
+				Link:    strings.TrimSpace(item.Link),
+				Summary: stripTags(firstNonEmpty(item.Description, item.Content)),
+			}
+			if t, ok := parseDate(firstNonEmpty(item.PubDate, item.Date)); ok {
+				entry.Published = &t
+			}
+			if entry.ID == "" {
+				entry.ID = entry.Link
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		return feed, nil
+
+	case "feed":
+		var doc atomDoc
+		if err := newXMLDecoder(body).Decode(&doc); err != nil {
+			return nil, err
+		}
+		feed := &Feed{Title: strings.TrimSpace(doc.Title), Link: alternateLink(doc.Links)}
+		for _, e := range doc.Entries {
+			entry := FeedEntry{
+				ID:      strings.TrimSpace(e.ID),
+				Title:   strings.TrimSpace(e.Title),
+				Link:    alternateLink(e.Links),
+				Summary: stripTags(firstNonEmpty(e.Summary, e.Content)),
+			}
+			if t, ok := parseDate(firstNonEmpty(e.Published, e.Updated)); ok {
+				entry.Published = &t
+			}
+			if entry.ID == "" {
+				entry.ID = entry.Link
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		return feed, nil
+	}
+
+	return nil, ErrNotFeed
+}
+
+func rootElement(body []byte) (string, error) {
+	dec := newXMLDecoder(body)
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", ErrNotFeed
+			}
+			return "", err
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
+
+func alternateLink(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	if len(links) > 0 {
+		return strings.TrimSpace(links[0].Href)
+	}
+	return ""
+}
+
+// stripTags returns the text of an HTML fragment, as found in feed summaries.
+func stripTags(s string) string {
+	if !strings.Contains(s, "<") {
+		return collapseSpace(html.UnescapeString(s))
+	}
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return collapseSpace(s)
+	}
+	return textFromNode(doc)
+}
@@ -0,0 +1,137 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/devraulu/crowlr/pkg/config"
+	"golang.org/x/net/html"
+)
+
+func init() {
+	Register("fields", newFieldExtractor)
+}
+
+var cssAttrSuffix = regexp.MustCompile(`::attr\(([^)]+)\)\s*$`)
+
+type fieldSelector struct {
+	name  string
+	css   cascadia.Sel
+	attr  string
+	xpath *xpath.Expr
+}
+
+type extractRule struct {
+	name      string
+	url       *regexp.Regexp
+	selectors []fieldSelector
+}
+
+type fieldExtractor struct {
+	rules []extractRule
+}
+
+func newFieldExtractor(cfg *config.Config) (Processor, error) {
+	fe := &fieldExtractor{}
+
+	for i, rule := range cfg.Extract {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("extract[%d]", i)
+		}
+
+		re, err := regexp.Compile(rule.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		r := extractRule{name: name, url: re}
+
+		for field, expr := range rule.CSS {
+			sel := fieldSelector{name: field}
+			if m := cssAttrSuffix.FindStringSubmatchIndex(expr); m != nil {
+				sel.attr = strings.TrimSpace(expr[m[2]:m[3]])
+				expr = expr[:m[0]]
+			}
+			sel.css, err = cascadia.Parse(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: css field %s: %w", name, field, err)
+			}
+			r.selectors = append(r.selectors, sel)
+		}
+
+		for field, expr := range rule.XPath {
+			compiled, err := xpath.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("%s: xpath field %s: %w", name, field, err)
+			}
+			r.selectors = append(r.selectors, fieldSelector{name: field, xpath: compiled})
+		}
+
+		fe.rules = append(fe.rules, r)
+	}
+
+	return fe, nil
+}
+
+// Process applies every rule whose URL pattern matches the document and
+// stores the first match of each selector. Later rules win on name clashes.
+func (fe *fieldExtractor) Process(ctx context.Context, doc *Document) error {
+	if doc.Root == nil {
+		return nil
+	}
+
+	for _, rule := range fe.rules {
+		if !rule.url.MatchString(doc.URL) {
+			continue
+		}
+
+		for _, sel := range rule.selectors {
+			value, ok := sel.match(doc.Root)
+			if !ok {
+				continue
+			}
+			if doc.Page.Fields == nil {
+				doc.Page.Fields = make(map[string]string)
+			}
+			doc.Page.Fields[sel.name] = value
+		}
+	}
+
+	return nil
+}
+
+func (s fieldSelector) match(root *html.Node) (string, bool) {
+	if s.xpath != nil {
+		n := htmlquery.QuerySelector(root, s.xpath)
+		if n == nil {
+			return "", false
+		}
+		return collapseSpace(htmlquery.InnerText(n)), true
+	}
+
+	n := cascadia.Query(root, s.css)
+	if n == nil {
+		return "", false
+	}
+
+	if s.attr != "" {
+		for _, attr := range n.Attr {
+			if attr.Key == s.attr {
+				return strings.TrimSpace(attr.Val), true
+			}
+		}
+		return "", false
+	}
+
+	return textFromNode(n), true
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
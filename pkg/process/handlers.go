@@ -0,0 +1,259 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+func init() {
+	RegisterContentHandler("text/html", ContentHandlerFunc(handleHTML))
+	RegisterContentHandler("application/xhtml+xml", ContentHandlerFunc(handleXHTML))
+	RegisterContentHandler("text/plain", ContentHandlerFunc(handleText))
+	RegisterContentHandler("application/pdf", ContentHandlerFunc(handlePDF))
+	for _, t := range []string{"application/xml", "text/xml", "application/rss+xml", "application/atom+xml", "application/rdf+xml"} {
+		RegisterContentHandler(t, ContentHandlerFunc(handleXML))
+	}
+}
+
+// maxTitleLen caps titles derived from document text rather than metadata.
+const maxTitleLen = 120
+
+func handleHTML(ctx context.Context, doc *Document) error {
+	if !strings.HasPrefix(http.DetectContentType(doc.Body), "text/html") {
+		doc.Skip("body is not html")
+		return nil
+	}
+	return handleXHTML(ctx, doc)
+}
+
+func handleXHTML(ctx context.Context, doc *Document) error {
+	root, err := html.Parse(bytes.NewReader(doc.Body))
+	if err != nil {
+		return err
+	}
+
+	doc.Root = root
+	doc.Page.HTML = string(doc.Body)
+	return nil
+}
+
+func handleText(ctx context.Context, doc *Document) error {
+	text := cleanText(string(doc.Body))
+	doc.Page.Content = collapseSpace(text)
+	doc.Page.Title = firstLine(text)
+	return nil
+}
+
+func handlePDF(ctx context.Context, doc *Document) (err error) {
+	defer func() {
+		// the pdf package panics on some malformed files
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed pdf: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(doc.Body), int64(len(doc.Body)))
+	if err != nil {
+		return err
+	}
+
+	textReader, err := r.GetPlainText()
+	if err != nil {
+		return err
+	}
+
+	text, err := io.ReadAll(textReader)
+	if err != nil {
+		return err
+	}
+
+	doc.Page.Content = collapseSpace(cleanText(string(text)))
+	doc.Page.Title = collapseSpace(cleanText(r.Trailer().Key("Info").Key("Title").Text()))
+	if doc.Page.Title == "" {
+		doc.Page.Title = fileName(doc.URL)
+	}
+
+	return nil
+}
+
+func handleXML(ctx context.Context, doc *Document) error {
+	feed, err := ParseFeed(doc.Body)
+	if err == nil {
+		doc.Page.Title = feed.Title
+		doc.Feeds = append(doc.Feeds, doc.URL)
+		var sb strings.Builder
+		for _, e := range feed.Entries {
+			sb.WriteString(e.Title)
+			sb.WriteString(" ")
+			sb.WriteString(e.Summary)
+			sb.WriteString(" ")
+			if link := resolveAgainst(doc.URL, e.Link); link != "" {
+				doc.Outlinks = append(doc.Outlinks, link)
+			}
+		}
+		doc.Page.Content = collapseSpace(sb.String())
+		return nil
+	}
+	if !errors.Is(err, ErrNotFeed) {
+		return err
+	}
+
+	scan, err := scanXML(doc.Body)
+	if err != nil {
+		return err
+	}
+
+	// sitemaps only contribute links
+	if scan.Root == "urlset" || scan.Root == "sitemapindex" {
+		for _, loc := range scan.Locs {
+			link := resolveAgainst(doc.URL, loc)
+			if link == "" {
+				continue
+			}
+			doc.Outlinks = append(doc.Outlinks, link)
+			if p, ok := scan.Priorities[loc]; ok {
+				if doc.Priorities == nil {
+					doc.Priorities = make(map[string]float64)
+				}
+				doc.Priorities[link] = p
+			}
+		}
+		doc.Skip("sitemap")
+		return nil
+	}
+
+	doc.Page.Content = collapseSpace(scan.Text)
+	doc.Page.Title = fileName(doc.URL)
+	return nil
+}
+
+// newXMLDecoder returns a decoder for body that reads documents declaring
+// encodings such as ISO-8859-1 or windows-1251 in their prolog as UTF-8.
+func newXMLDecoder(body []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = charset.NewReaderLabel
+	return dec
+}
+
+// xmlScan is what scanXML finds in a generic XML document.
+type xmlScan struct {
+	Root string
+	// Locs are the texts of any <loc> elements.
+	Locs []string
+	// Priorities maps sitemap <url> locs to their <priority>.
+	Priorities map[string]float64
+	Text       string
+}
+
+// scanXML returns the root element name, sitemap locations and priorities,
+// and all character data of a generic XML document.
+func scanXML(body []byte) (*xmlScan, error) {
+	dec := newXMLDecoder(body)
+	dec.Strict = false
+
+	scan := &xmlScan{Priorities: make(map[string]float64)}
+	var sb strings.Builder
+	var elem, loc, priority string
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if scan.Root == "" {
+				scan.Root = t.Name.Local
+			}
+			elem = t.Name.Local
+			if elem == "url" {
+				loc, priority = "", ""
+			}
+		case xml.EndElement:
+			if t.Name.Local == "url" && loc != "" {
+				if p, err := strconv.ParseFloat(priority, 64); err == nil && p >= 0 && p <= 1 {
+					scan.Priorities[loc] = p
+				}
+			}
+			elem = ""
+		case xml.CharData:
+			s := strings.TrimSpace(string(t))
+			if s == "" {
+				continue
+			}
+			switch elem {
+			case "loc":
+				scan.Locs = append(scan.Locs, s)
+				loc = s
+			case "priority":
+				priority = s
+			}
+			sb.WriteString(s)
+			sb.WriteString(" ")
+		}
+	}
+
+	scan.Text = sb.String()
+	return scan, nil
+}
+
+// cleanText makes extracted text safe for a text column: valid UTF-8 and no
+// NUL bytes.
+func cleanText(s string) string {
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	return strings.ReplaceAll(s, "\x00", "")
+}
+
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = collapseSpace(line); line != "" {
+			if utf8.RuneCountInString(line) > maxTitleLen {
+				line = string([]rune(line)[:maxTitleLen])
+			}
+			return line
+		}
+	}
+	return ""
+}
+
+func fileName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+func resolveAgainst(baseURL, ref string) string {
+	base, err := url.Parse(baseURL)
+	if err != nil || ref == "" {
+		return ""
+	}
+	return resolve(ref, base)
+}
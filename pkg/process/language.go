@@ -0,0 +1,29 @@
+package process
+
+import (
+	"context"
+
+	"github.com/devraulu/crowlr/pkg/lang"
+)
+
+func init() {
+	Register("language", newStatic(processLanguage))
+}
+
+// processLanguage keeps a language declared by the page or the server and
+// otherwise detects it from the extracted text.
+func processLanguage(ctx context.Context, doc *Document) error {
+	if doc.Page.Language != "" {
+		return nil
+	}
+
+	if doc.Response != nil {
+		if cl := normalizeLanguage(doc.Response.Header.Get("Content-Language")); cl != "" {
+			doc.Page.Language = cl
+			return nil
+		}
+	}
+
+	doc.Page.Language = lang.Detect(firstNonEmpty(doc.Page.MainContent, doc.Page.Content))
+	return nil
+}
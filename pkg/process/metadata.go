@@ -0,0 +1,255 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+	"golang.org/x/net/html"
+)
+
+func init() {
+	Register("metadata", newStatic(processMetadata))
+}
+
+type Metadata struct {
+	Description string
+	Keywords    []string
+	Language    string
+	Headings    []string
+	PublishedAt *time.Time
+	OpenGraph   map[string]string
+	Twitter     map[string]string
+	JSONLD      []json.RawMessage
+}
+
+// publishedKeys are the meta names and properties that carry a publish date,
+// in order of preference.
+var publishedKeys = []string{
+	"article:published_time",
+	"og:published_time",
+	"datepublished",
+	"date",
+	"dc.date",
+	"dc.date.issued",
+	"pubdate",
+	"publish-date",
+	"sailthru.date",
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+func ExtractMetadata(root *html.Node) *Metadata {
+	m := &Metadata{
+		OpenGraph: make(map[string]string),
+		Twitter:   make(map[string]string),
+	}
+	meta := make(map[string]string)
+	var timeTag string
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "html":
+				if lang := attr(n, "lang"); lang != "" && m.Language == "" {
+					m.Language = lang
+				}
+			case "meta":
+				key := strings.ToLower(attr(n, "property"))
+				if key == "" {
+					key = strings.ToLower(attr(n, "name"))
+				}
+				if key == "" {
+					key = strings.ToLower(attr(n, "itemprop"))
+				}
+				if key == "" {
+					key = strings.ToLower(attr(n, "http-equiv"))
+				}
+				content := strings.TrimSpace(attr(n, "content"))
+				if key == "" || content == "" {
+					break
+				}
+				switch {
+				case strings.HasPrefix(key, "og:"), strings.HasPrefix(key, "article:"):
+					m.OpenGraph[key] = content
+				case strings.HasPrefix(key, "twitter:"):
+					m.Twitter[key] = content
+				}
+				if _, ok := meta[key]; !ok {
+					meta[key] = content
+				}
+			case "h1", "h2", "h3":
+				if text := textFromNode(n); text != "" {
+					m.Headings = append(m.Headings, text)
+				}
+			case "time":
+				if timeTag == "" {
+					timeTag = attr(n, "datetime")
+				}
+			case "script":
+				if strings.EqualFold(strings.TrimSpace(attr(n, "type")), "application/ld+json") && n.FirstChild != nil {
+					raw := strings.TrimSpace(n.FirstChild.Data)
+					if json.Valid([]byte(raw)) {
+						m.JSONLD = append(m.JSONLD, json.RawMessage(raw))
+					}
+				}
+				return
+			case "style", "noscript", "svg":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	m.Description = firstNonEmpty(meta["description"], meta["og:description"], meta["twitter:description"])
+
+	for _, kw := range strings.Split(meta["keywords"], ",") {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			m.Keywords = append(m.Keywords, kw)
+		}
+	}
+
+	if m.Language == "" {
+		m.Language = meta["content-language"]
+	}
+	m.Language = normalizeLanguage(m.Language)
+
+	var candidates []string
+	for _, key := range publishedKeys {
+		candidates = append(candidates, meta[key])
+	}
+	candidates = append(candidates, jsonLDDatePublished(m.JSONLD), timeTag)
+	for _, c := range candidates {
+		if t, ok := parseDate(c); ok {
+			m.PublishedAt = &t
+			break
+		}
+	}
+
+	return m
+}
+
+func processMetadata(ctx context.Context, doc *Document) error {
+	if doc.Root == nil {
+		return nil
+	}
+
+	m := ExtractMetadata(doc.Root)
+
+	if m.Language == "" && doc.Response != nil {
+		m.Language = normalizeLanguage(doc.Response.Header.Get("Content-Language"))
+	}
+
+	if doc.Page.Title == "" {
+		doc.Page.Title = firstNonEmpty(m.OpenGraph["og:title"], m.Twitter["twitter:title"])
+	}
+
+	doc.Page.Description = m.Description
+	doc.Page.Keywords = m.Keywords
+	doc.Page.Language = m.Language
+	doc.Page.Headings = m.Headings
+	doc.Page.PublishedAt = m.PublishedAt
+	doc.Page.Metadata = storage.Metadata{
+		OpenGraph: nonEmptyMap(m.OpenGraph),
+		Twitter:   nonEmptyMap(m.Twitter),
+		JSONLD:    m.JSONLD,
+	}
+
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func nonEmptyMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// normalizeLanguage lowercases a language tag and keeps only the first one
+// when a Content-Language header lists several.
+func normalizeLanguage(lang string) string {
+	lang, _, _ = strings.Cut(lang, ",")
+	return strings.ToLower(strings.TrimSpace(strings.ReplaceAll(lang, "_", "-")))
+}
+
+func parseDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// jsonLDDatePublished looks for a datePublished property anywhere in the
+// JSON-LD blocks, including inside @graph arrays.
+func jsonLDDatePublished(blocks []json.RawMessage) string {
+	var find func(v any) string
+	find = func(v any) string {
+		switch v := v.(type) {
+		case map[string]any:
+			if s, ok := v["datePublished"].(string); ok && s != "" {
+				return s
+			}
+			for _, child := range v {
+				if s := find(child); s != "" {
+					return s
+				}
+			}
+		case []any:
+			for _, child := range v {
+				if s := find(child); s != "" {
+					return s
+				}
+			}
+		}
+		return ""
+	}
+
+	for _, raw := range blocks {
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			continue
+		}
+		if s := find(v); s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -1,16 +1,197 @@
 package process
 
-import "github.com/PuerkitoBio/purell"
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/PuerkitoBio/purell"
+	"golang.org/x/net/idna"
+
+	"github.com/devraulu/crowlr/pkg/config"
+)
+
+const normalizeFlags = purell.FlagLowercaseScheme |
+	purell.FlagLowercaseHost |
+	purell.FlagRemoveDefaultPort |
+	purell.FlagRemoveFragment |
+	purell.FlagDecodeUnnecessaryEscapes |
+	purell.FlagSortQuery |
+	purell.FlagRemoveDuplicateSlashes |
+	purell.FlagRemoveDotSegments
+
+// Normalize applies only the syntactic normalizations: casing, default
+// ports, fragments, escapes, query order, duplicate slashes and dot
+// segments. Normalizer adds the configured rules on top.
 func Normalize(url string) (string, error) {
-	flags := purell.FlagLowercaseScheme |
-		purell.FlagLowercaseHost |
-		purell.FlagRemoveDefaultPort |
-		purell.FlagRemoveFragment |
-		purell.FlagDecodeUnnecessaryEscapes |
-		purell.FlagSortQuery |
-		purell.FlagRemoveDuplicateSlashes |
-		purell.FlagRemoveDotSegments
-
-	return purell.NormalizeURLString(url, flags)
+	return purell.NormalizeURLString(url, normalizeFlags)
+}
+
+// Normalizer normalizes URLs with the rules of a config.NormalizeConfig, so
+// seeds, outlinks and feed entries that point to the same page get the same
+// key.
+type Normalizer struct {
+	cfg   config.NormalizeConfig
+	strip paramMatcher
+}
+
+func NewNormalizer(cfg config.NormalizeConfig) *Normalizer {
+	return &Normalizer{
+		cfg:   cfg,
+		strip: newParamMatcher(cfg.StripParams),
+	}
+}
+
+// Normalize returns the normalized form of rawURL.
+func (n *Normalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if n.cfg.IDN && !isASCII(host) {
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", err
+		}
+	}
+
+	rule := n.rule(host)
+
+	removeWWW := n.cfg.RemoveWWW
+	if rule != nil && rule.RemoveWWW != nil {
+		removeWWW = *rule.RemoveWWW
+	}
+	if removeWWW && strings.HasPrefix(host, "www.") && strings.Contains(host[len("www."):], ".") {
+		host = host[len("www."):]
+	}
+
+	port := u.Port()
+	if strings.Contains(host, ":") {
+		// IPv6 literal
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	strip, keep := n.strip, paramMatcher(nil)
+	if rule != nil {
+		strip = append(newParamMatcher(rule.StripParams), strip...)
+		keep = newParamMatcher(rule.KeepParams)
+	}
+	drop := func(name string) bool {
+		return strip.match(name) || (keep != nil && !keep.match(name))
+	}
+
+	path := u.EscapedPath()
+	if strings.Contains(path, ";") {
+		path = stripPathParams(path, strip)
+	}
+	if rule != nil && rule.LowercasePath {
+		path = strings.ToLower(path)
+	}
+	for _, index := range n.cfg.IndexFiles {
+		if dir, ok := strings.CutSuffix(path, "/"+index); ok {
+			path = dir + "/"
+			break
+		}
+	}
+	if path != u.EscapedPath() {
+		unescaped, err := url.PathUnescape(path)
+		if err != nil {
+			return "", err
+		}
+		u.Path, u.RawPath = unescaped, path
+	}
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		removed := false
+		for name := range q {
+			if drop(name) {
+				q.Del(name)
+				removed = true
+			}
+		}
+		if removed {
+			u.RawQuery = q.Encode()
+		}
+	}
+
+	return purell.NormalizeURL(u, normalizeFlags), nil
+}
+
+// rule returns the host rule with the longest host matching host or one of
+// its parent domains.
+func (n *Normalizer) rule(host string) *config.HostNormalizeRule {
+	var best *config.HostNormalizeRule
+	for i := range n.cfg.Hosts {
+		r := &n.cfg.Hosts[i]
+		h := strings.ToLower(r.Host)
+		if host != h && !strings.HasSuffix(host, "."+h) {
+			continue
+		}
+		if best == nil || len(h) > len(best.Host) {
+			best = r
+		}
+	}
+	return best
+}
+
+// stripPathParams removes ;name=value parameters matched by strip from each
+// segment of an escaped path, e.g. ;jsessionid=... in Java apps.
+func stripPathParams(path string, strip paramMatcher) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		parts := strings.Split(seg, ";")
+		kept := parts[:1]
+		for _, p := range parts[1:] {
+			name, _, _ := strings.Cut(p, "=")
+			if !strip.match(name) {
+				kept = append(kept, p)
+			}
+		}
+		segments[i] = strings.Join(kept, ";")
+	}
+	return strings.Join(segments, "/")
+}
+
+// paramMatcher matches parameter names case-insensitively against names or,
+// for entries ending in *, prefixes.
+type paramMatcher []string
+
+func newParamMatcher(patterns []string) paramMatcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+	m := make(paramMatcher, len(patterns))
+	for i, p := range patterns {
+		m[i] = strings.ToLower(p)
+	}
+	return m
+}
+
+func (m paramMatcher) match(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range m {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,132 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/storage"
+	"golang.org/x/net/html"
+)
+
+// Document is a fetched page as seen by processors. Processors fill in Page,
+// append to Outlinks and Feeds, or call Skip to keep the page out of storage.
+type Document struct {
+	URL      string
+	Response *http.Response
+	Body     []byte
+	Root     *html.Node
+	Page     *storage.Page
+	Outlinks []string
+	Feeds    []string
+	// Priorities holds crawl priority hints between 0 and 1 for outlinks,
+	// keyed by absolute URL, such as sitemap <priority> values.
+	Priorities map[string]float64
+
+	skipReason string
+}
+
+// Skip vetoes storing the page. Outlinks are still followed.
+func (d *Document) Skip(reason string) {
+	if d.skipReason == "" {
+		d.skipReason = reason
+	}
+}
+
+func (d *Document) Skipped() (string, bool) {
+	return d.skipReason, d.skipReason != ""
+}
+
+type Processor interface {
+	Process(ctx context.Context, doc *Document) error
+}
+
+// ProcessorFunc adapts a plain function to the Processor interface.
+type ProcessorFunc func(ctx context.Context, doc *Document) error
+
+func (f ProcessorFunc) Process(ctx context.Context, doc *Document) error {
+	return f(ctx, doc)
+}
+
+// Factory builds a processor from the crawl config.
+type Factory func(cfg *config.Config) (Processor, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a processor available by name to the processing.processors
+// config list. It panics if the name is already taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("process: Register factory is nil")
+	}
+	if _, dup := registry[name]; dup {
+		panic("process: Register called twice for processor " + name)
+	}
+	registry[name] = factory
+}
+
+// Processors returns the names of all registered processors.
+func Processors() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registeredNames()
+}
+
+func registeredNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type namedProcessor struct {
+	name string
+	Processor
+}
+
+type Pipeline struct {
+	processors []namedProcessor
+}
+
+// NewPipeline builds the processors listed in processing.processors, in
+// that order.
+func NewPipeline(cfg *config.Config) (*Pipeline, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	p := &Pipeline{}
+	for _, name := range cfg.Processing.Processors {
+		factory, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown processor %q (registered: %v)", name, registeredNames())
+		}
+		proc, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("processor %s: %w", name, err)
+		}
+		p.processors = append(p.processors, namedProcessor{name: name, Processor: proc})
+	}
+
+	return p, nil
+}
+
+// Run passes doc through every processor, stopping at the first error.
+func (p *Pipeline) Run(ctx context.Context, doc *Document) error {
+	for _, proc := range p.processors {
+		if err := proc.Process(ctx, doc); err != nil {
+			return fmt.Errorf("processor %s: %w", proc.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package process
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/devraulu/crowlr/pkg/config"
+)
+
+func init() {
+	Register("links", newStatic(processLinks))
+	Register("title", newStatic(processTitle))
+	Register("text", newStatic(processText))
+}
+
+func newStatic(fn ProcessorFunc) Factory {
+	return func(*config.Config) (Processor, error) {
+		return fn, nil
+	}
+}
+
+func processLinks(ctx context.Context, doc *Document) error {
+	if doc.Root == nil {
+		return nil
+	}
+
+	base, err := url.Parse(doc.URL)
+	if err != nil {
+		return err
+	}
+
+	if newBaseStr := findBase(doc.Root); newBaseStr != "" {
+		if newBase, err := base.Parse(newBaseStr); err == nil {
+			base = newBase
+		}
+	}
+
+	doc.Outlinks = append(doc.Outlinks, extractAndResolve(doc.Root, base)...)
+	doc.Feeds = append(doc.Feeds, findFeeds(doc.Root, base)...)
+	return nil
+}
+
+func processTitle(ctx context.Context, doc *Document) error {
+	if doc.Root == nil || doc.Page.Title != "" {
+		return nil
+	}
+	doc.Page.Title = extractTitle(doc.Root)
+	return nil
+}
+
+func processText(ctx context.Context, doc *Document) error {
+	if doc.Root == nil {
+		return nil
+	}
+	doc.Page.Content = textFromNode(doc.Root)
+	return nil
+}
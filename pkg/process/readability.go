@@ -0,0 +1,261 @@
+package process
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+func init() {
+	Register("maincontent", newStatic(processMainContent))
+}
+
+var (
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text|blog`)
+	negativeHint = regexp.MustCompile(`(?i)banner|breadcrumb|comment|consent|cookie|footer|footnote|header|menu|meta|modal|nav|newsletter|popup|promo|related|share|sidebar|social|sponsor|subscribe|widget|\bad-|\bads\b`)
+)
+
+// minMainContentLen is the shortest main content worth keeping. Below it the
+// page is probably not an article and the full text is a better signal.
+const minMainContentLen = 140
+
+// skippedTags never contribute to main content.
+var skippedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "iframe": true, "svg": true,
+	"nav": true, "footer": true, "aside": true, "header": true, "form": true,
+	"button": true, "select": true, "template": true, "dialog": true,
+}
+
+// scoredTags are the leaf blocks whose text scores their ancestors.
+var scoredTags = map[string]bool{
+	"p": true, "pre": true, "td": true, "blockquote": true, "li": true, "dd": true,
+	"h2": true, "h3": true, "h4": true,
+}
+
+type blockStats struct {
+	textLen int
+	linkLen int
+}
+
+type scorer struct {
+	stats  map[*html.Node]*blockStats
+	scores map[*html.Node]float64
+}
+
+// ExtractMainContent returns the text of the DOM block that most likely holds
+// the page's main content, readability-style: text blocks score their parent
+// and grandparent by length and comma count, class and id names nudge the
+// score, and the result is scaled down by link density. Siblings that score
+// close to the winner are included. It returns "" when nothing qualifies.
+func ExtractMainContent(root *html.Node) string {
+	s := &scorer{
+		stats:  make(map[*html.Node]*blockStats),
+		scores: make(map[*html.Node]float64),
+	}
+	s.collect(root, false)
+
+	// candidates are visited in document order, so ties go to the first
+	var top *html.Node
+	var topScore float64
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if score, ok := s.scores[n]; ok {
+			score *= 1 - s.linkDensity(n)
+			s.scores[n] = score
+			if top == nil || score > topScore {
+				top, topScore = n, score
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(root)
+	if top == nil {
+		return ""
+	}
+
+	threshold := max(10, topScore*0.2)
+	var parts []string
+
+	parent := top.Parent
+	if parent == nil {
+		parts = append(parts, blockText(top))
+	} else {
+		for c := parent.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c == top || s.scores[c] >= threshold || isDenseParagraph(s, c) {
+				parts = append(parts, blockText(c))
+			}
+		}
+	}
+
+	text := strings.TrimSpace(strings.Join(parts, " "))
+	if len(text) < minMainContentLen {
+		return ""
+	}
+	return text
+}
+
+// collect fills in text and link lengths for every element and scores the
+// ancestors of each text block. It returns the visible text length of n.
+func (s *scorer) collect(n *html.Node, inLink bool) blockStats {
+	if n.Type == html.TextNode {
+		l := len(strings.TrimSpace(n.Data))
+		if inLink {
+			return blockStats{textLen: l, linkLen: l}
+		}
+		return blockStats{textLen: l}
+	}
+
+	if n.Type == html.ElementNode {
+		if skippedTags[n.Data] || isHidden(n) {
+			return blockStats{}
+		}
+		if n.Data == "a" {
+			inLink = true
+		}
+	}
+
+	var total blockStats
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		st := s.collect(c, inLink)
+		total.textLen += st.textLen
+		total.linkLen += st.linkLen
+	}
+
+	if n.Type != html.ElementNode {
+		return total
+	}
+
+	st := total
+	s.stats[n] = &st
+
+	if scoredTags[n.Data] && total.textLen >= 25 {
+		text := textFromNode(n)
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+
+		if p := n.Parent; p != nil && p.Type == html.ElementNode {
+			s.addCandidate(p)
+			s.scores[p] += score
+			if gp := p.Parent; gp != nil && gp.Type == html.ElementNode {
+				s.addCandidate(gp)
+				s.scores[gp] += score / 2
+			}
+		}
+	}
+
+	return total
+}
+
+func (s *scorer) addCandidate(n *html.Node) {
+	if _, ok := s.scores[n]; ok {
+		return
+	}
+
+	var score float64
+	switch n.Data {
+	case "article", "main":
+		score += 10
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote", "section":
+		score += 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form", "address":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+
+	hint := attr(n, "class") + " " + attr(n, "id")
+	if negativeHint.MatchString(hint) {
+		score -= 25
+	}
+	if positiveHint.MatchString(hint) {
+		score += 25
+	}
+
+	s.scores[n] = score
+}
+
+func (s *scorer) linkDensity(n *html.Node) float64 {
+	st := s.stats[n]
+	if st == nil || st.textLen == 0 {
+		return 0
+	}
+	return float64(st.linkLen) / float64(st.textLen)
+}
+
+// isDenseParagraph keeps unscored sibling paragraphs that read like prose.
+func isDenseParagraph(s *scorer, n *html.Node) bool {
+	if n.Data != "p" {
+		return false
+	}
+	st := s.stats[n]
+	if st == nil {
+		return false
+	}
+	density := s.linkDensity(n)
+	text := textFromNode(n)
+	return (st.textLen > 80 && density < 0.25) ||
+		(st.textLen > 0 && density == 0 && strings.ContainsAny(text, ".!?"))
+}
+
+func isHidden(n *html.Node) bool {
+	if hasAttr(n, "hidden") {
+		return true
+	}
+	if attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// blockText is textFromNode without the boilerplate elements that sometimes
+// sit inside the content block.
+func blockText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (skippedTags[n.Data] || isHidden(n)) {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data != "body" {
+			hint := attr(n, "class") + " " + attr(n, "id")
+			if negativeHint.MatchString(hint) && !positiveHint.MatchString(hint) {
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return collapseSpace(sb.String())
+}
+
+func processMainContent(ctx context.Context, doc *Document) error {
+	if doc.Root == nil {
+		return nil
+	}
+	doc.Page.MainContent = ExtractMainContent(doc.Root)
+	return nil
+}
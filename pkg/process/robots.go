@@ -2,6 +2,7 @@ package process
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"log/slog"
 	"net/http"
@@ -9,35 +10,37 @@ import (
 	"github.com/benjaminestes/robots"
 )
 
-func CheckRobots(url string, cache map[string]*robots.Robots) *robots.Robots {
+// Fetcher sends HTTP requests, as *http.Client does.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// FetchRobots fetches and parses the robots.txt at robotsURL with f. It
+// returns nil when there are no rules or they can't be fetched, which allows
+// everything.
+func FetchRobots(ctx context.Context, f Fetcher, robotsURL string) (r *robots.Robots) {
 	defer func() {
-		if r := recover(); r != nil {
-			slog.Warn("panic in robots.txt parsing, assuming allowed", slog.String("url", url), slog.Any("panic", r))
+		if p := recover(); p != nil {
+			slog.Warn("panic in robots.txt parsing, assuming allowed", slog.String("url", robotsURL), slog.Any("panic", p))
+			r = nil
 		}
 	}()
 
-	robotsURL, err := robots.Locate(url)
-	if err != nil {
-		return nil
-	}
-
-	if r, ok := cache[robotsURL]; ok {
-		return r
-	}
-
-	r, err := getRobots(robotsURL)
+	r, err := getRobots(ctx, f, robotsURL)
 	if err != nil {
 		slog.Warn("failed to fetch robots.txt", slog.String("url", robotsURL), slog.Any("err", err))
-		cache[robotsURL] = nil
 		return nil
 	}
-
-	cache[robotsURL] = r
 	return r
 }
 
-func getRobots(url string) (*robots.Robots, error) {
-	resp, err := http.Get(url)
+func getRobots(ctx context.Context, f Fetcher, url string) (*robots.Robots, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.Do(req)
 	if err != nil {
 		return nil, err
 	}
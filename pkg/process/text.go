@@ -13,12 +13,16 @@ func ExtractText(body io.Reader) (string, error) {
 		return "", err
 	}
 
+	return textFromNode(doc), nil
+}
+
+func textFromNode(n *html.Node) string {
 	var sb strings.Builder
-	extractTextNodes(doc, &sb)
+	extractTextNodes(n, &sb)
 
 	text := sb.String()
 	text = strings.Join(strings.Fields(text), " ")
-	return strings.TrimSpace(text), nil
+	return strings.TrimSpace(text)
 }
 
 func extractTextNodes(n *html.Node, sb *strings.Builder) {
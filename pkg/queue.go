@@ -0,0 +1,131 @@
+package frontier
+
+import "time"
+
+// HostQueue holds the URLs waiting for one host, best score first. Host is
+// the politeness group key, which is the hostname unless the frontier groups
+// hosts by domain or address.
+type HostQueue struct {
+	Host      string
+	NextVisit time.Time
+	// Stats drive the host's delay when throttling is enabled
+	Stats HostStats
+	// SeedDelay replaces the default delay when a seed of the host sets one,
+	// and throttling never goes below it
+	SeedDelay time.Duration
+
+	// items is the in-memory head of the queue
+	items itemHeap
+	// pending and segments hold the spilled tail, newest last
+	pending  []*item
+	segments []segment
+	// index is the queue's position in Frontier.hosts, or -1 when empty
+	index int
+}
+
+type segment struct {
+	path  string
+	count int
+}
+
+// Len returns the number of URLs queued for the host, spilled ones included.
+func (hq *HostQueue) Len() int {
+	return hq.items.Len() + hq.spilled()
+}
+
+// delay is the host's adapted delay, or its base delay until it has one.
+func (hq *HostQueue) delay(defaultDelay time.Duration) time.Duration {
+	if hq.Stats.Samples == 0 {
+		return hq.baseDelay(defaultDelay)
+	}
+	return hq.Stats.Delay
+}
+
+// baseDelay is the seed delay of the host if it has one, else defaultDelay.
+func (hq *HostQueue) baseDelay(defaultDelay time.Duration) time.Duration {
+	if hq.SeedDelay > 0 {
+		return hq.SeedDelay
+	}
+	return defaultDelay
+}
+
+func (hq *HostQueue) spilled() int {
+	n := len(hq.pending)
+	for _, seg := range hq.segments {
+		n += seg.count
+	}
+	return n
+}
+
+type item struct {
+	Candidate
+	host  string
+	score float64
+	front bool
+	// seq breaks ties in push order
+	seq   uint64
+	index int
+}
+
+// itemHeap is a max-heap on score, FIFO among equal scores.
+type itemHeap []*item
+
+func (h itemHeap) Len() int { return len(h) }
+
+func (h itemHeap) Less(i, j int) bool {
+	if h[i].score != h[j].score {
+		return h[i].score > h[j].score
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h itemHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *itemHeap) Push(x any) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *itemHeap) Pop() any {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	old[n-1] = nil
+	it.index = -1
+	*h = old[:n-1]
+	return it
+}
+
+// hostHeap is a min-heap on NextVisit.
+type hostHeap []*HostQueue
+
+func (h hostHeap) Len() int { return len(h) }
+
+func (h hostHeap) Less(i, j int) bool { return h[i].NextVisit.Before(h[j].NextVisit) }
+
+func (h hostHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hostHeap) Push(x any) {
+	hq := x.(*HostQueue)
+	hq.index = len(*h)
+	*h = append(*h, hq)
+}
+
+func (h *hostHeap) Pop() any {
+	old := *h
+	n := len(old)
+	hq := old[n-1]
+	old[n-1] = nil
+	hq.index = -1
+	*h = old[:n-1]
+	return hq
+}
@@ -0,0 +1,129 @@
+package frontier
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/devraulu/crowlr/pkg/config"
+)
+
+// Scorer rates a candidate URL. Within a host, higher scores are crawled
+// first.
+type Scorer interface {
+	Score(c Candidate) float64
+}
+
+type ScorerFunc func(c Candidate) float64
+
+func (f ScorerFunc) Score(c Candidate) float64 {
+	return f(c)
+}
+
+// DepthScorer prefers URLs fewer links away from a seed, which gives a
+// breadth-first crawl.
+type DepthScorer struct{}
+
+func (DepthScorer) Score(c Candidate) float64 {
+	return -float64(c.Depth)
+}
+
+// InlinkScorer prefers URLs that were linked from more pages.
+type InlinkScorer struct{}
+
+func (InlinkScorer) Score(c Candidate) float64 {
+	return math.Log1p(float64(c.Inlinks))
+}
+
+// PriorityScorer uses the candidate's priority hint, such as a sitemap
+// <priority>, falling back to the sitemap default of 0.5.
+type PriorityScorer struct{}
+
+func (PriorityScorer) Score(c Candidate) float64 {
+	if c.Priority == 0 {
+		return 0.5
+	}
+	return c.Priority
+}
+
+// LengthScorer prefers short URLs, which tend to be hub and index pages.
+type LengthScorer struct{}
+
+func (LengthScorer) Score(c Candidate) float64 {
+	return -float64(len(c.Normalized)) / 100
+}
+
+// KeywordScorer prefers URLs containing any of its lowercase keywords,
+// scoring one per keyword found.
+type KeywordScorer struct {
+	Keywords []string
+}
+
+func (s KeywordScorer) Score(c Candidate) float64 {
+	url := strings.ToLower(c.Normalized)
+	var score float64
+	for _, kw := range s.Keywords {
+		if strings.Contains(url, kw) {
+			score++
+		}
+	}
+	return score
+}
+
+// WeightedScorer sums the scores of its scorers, each multiplied by its
+// weight.
+type WeightedScorer struct {
+	Scorers []Scorer
+	Weights []float64
+}
+
+func (s WeightedScorer) Score(c Candidate) float64 {
+	var score float64
+	for i, scorer := range s.Scorers {
+		score += s.Weights[i] * scorer.Score(c)
+	}
+	return score
+}
+
+// NewScorer builds the weighted scorer described by frontier.scoring.
+func NewScorer(cfg config.FrontierConfig) (Scorer, error) {
+	names := make([]string, 0, len(cfg.Scoring))
+	for name := range cfg.Scoring {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ws WeightedScorer
+	for _, name := range names {
+		var s Scorer
+		switch name {
+		case "depth":
+			s = DepthScorer{}
+		case "inlinks":
+			s = InlinkScorer{}
+		case "priority":
+			s = PriorityScorer{}
+		case "length":
+			s = LengthScorer{}
+		case "keywords":
+			if len(cfg.Keywords) == 0 {
+				return nil, fmt.Errorf("scorer %q needs frontier.keywords", name)
+			}
+			keywords := make([]string, len(cfg.Keywords))
+			for i, kw := range cfg.Keywords {
+				keywords[i] = strings.ToLower(kw)
+			}
+			s = KeywordScorer{Keywords: keywords}
+		default:
+			return nil, fmt.Errorf("unknown scorer %q", name)
+		}
+		ws.Scorers = append(ws.Scorers, s)
+		ws.Weights = append(ws.Weights, cfg.Scoring[name])
+	}
+
+	if len(ws.Scorers) == 0 {
+		return DepthScorer{}, nil
+	}
+	return ws, nil
+}
@@ -2,10 +2,18 @@ package frontier
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/devraulu/crowlr/pkg/config"
 	"github.com/devraulu/crowlr/pkg/process"
 )
 
@@ -13,33 +21,199 @@ var (
 	ErrNoSeeds = errors.New("no seeds loaded")
 )
 
-func LoadSeeds(path string, f *Frontier) error {
+// Seed scopes limit which discovered links of a seed are followed.
+const (
+	ScopeHost   = "host"
+	ScopeDomain = "domain"
+	ScopePrefix = "prefix"
+)
+
+// SeedOptions are the per-seed settings of a seeds file. Every URL reached
+// from the seed carries them.
+type SeedOptions struct {
+	// URL is the seed's normalized URL, which Scope is relative to.
+	URL string `json:"url"`
+	// MaxDepth is how many links may be followed from the seed; nil means
+	// no limit.
+	MaxDepth *int `json:"max_depth,omitempty"`
+	// Scope is "" for anywhere, or ScopeHost, ScopeDomain or ScopePrefix.
+	Scope string `json:"scope,omitempty"`
+	// Priority is given to URLs of the seed that have none of their own.
+	Priority float64 `json:"priority,omitempty"`
+	// Delay replaces the politeness delay of the seed's host when set.
+	Delay time.Duration `json:"delay,omitempty"`
+	// Tags are stored with every page crawled from the seed.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Follows reports whether a link at depth found while crawling from the
+// seed should be queued.
+func (o *SeedOptions) Follows(rawURL string, depth int) bool {
+	if o.MaxDepth != nil && depth > *o.MaxDepth {
+		return false
+	}
+
+	switch o.Scope {
+	case ScopeHost:
+		host, err := getHost(rawURL)
+		seedHost, _ := getHost(o.URL)
+		return err == nil && host == seedHost
+	case ScopeDomain:
+		host, err := getHost(rawURL)
+		seedHost, _ := getHost(o.URL)
+		return err == nil && DomainKey(host) == DomainKey(seedHost)
+	case ScopePrefix:
+		return inPrefix(rawURL, o.URL)
+	}
+	return true
+}
+
+// inPrefix reports whether rawURL is prefix or under it, matching whole path
+// segments: /docs covers /docs/intro and /docs?page=2 but not /docs-old.
+func inPrefix(rawURL, prefix string) bool {
+	rest, ok := strings.CutPrefix(rawURL, prefix)
+	return ok && (rest == "" || strings.HasSuffix(prefix, "/") || strings.HasPrefix(rest, "/") || strings.HasPrefix(rest, "?"))
+}
+
+// seedEntry is one seed in a JSON or TOML seeds file.
+type seedEntry struct {
+	URL      string          `json:"url" toml:"url"`
+	MaxDepth *int            `json:"max_depth" toml:"max_depth"`
+	Scope    string          `json:"scope" toml:"scope"`
+	Priority float64         `json:"priority" toml:"priority"`
+	Delay    config.Duration `json:"delay" toml:"delay"`
+	Tags     []string        `json:"tags" toml:"tags"`
+}
+
+func (e seedEntry) validate() error {
+	if e.URL == "" {
+		return errors.New("url is required")
+	}
+	if e.MaxDepth != nil && *e.MaxDepth < 0 {
+		return fmt.Errorf("max_depth must not be negative, got %d", *e.MaxDepth)
+	}
+	switch e.Scope {
+	case "", ScopeHost, ScopeDomain, ScopePrefix:
+	default:
+		return fmt.Errorf("scope must be %s, %s or %s, got %q", ScopeHost, ScopeDomain, ScopePrefix, e.Scope)
+	}
+	if e.Priority < 0 || e.Priority > 1 {
+		return fmt.Errorf("priority must be between 0 and 1, got %g", e.Priority)
+	}
+	if e.Delay.Duration < 0 {
+		return fmt.Errorf("delay must not be negative, got %s", e.Delay)
+	}
+	return nil
+}
+
+// LoadSeeds queues every seed in the file at path, normalized with n. Files
+// ending in .json or .toml list seeds with per-seed options; any other file
+// has one URL per line, with blank lines and # comments ignored.
+func LoadSeeds(path string, f Queue, n *process.Normalizer) error {
 	slog.Info("loading seeds", "path", path)
-	file, err := os.Open(path)
+
+	var entries []seedEntry
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		entries, err = readJSONSeeds(path)
+	case ".toml":
+		entries, err = readTOMLSeeds(path)
+	default:
+		entries, err = readTextSeeds(path)
+	}
 	if err != nil {
 		return err
 	}
+
+	loaded, added := 0, 0
+	for i, e := range entries {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("seed %d (%s): %w", i+1, e.URL, err)
+		}
+
+		normalized, err := n.Normalize(e.URL)
+		if err != nil {
+			slog.Error("couldn't normalize seed", slog.String("seed", e.URL), slog.Any("err", err))
+			continue
+		}
+
+		c := Candidate{Original: e.URL, Normalized: normalized, Priority: e.Priority}
+		if e.MaxDepth != nil || e.Scope != "" || e.Priority != 0 || e.Delay.Duration != 0 || len(e.Tags) > 0 {
+			c.Seed = &SeedOptions{
+				URL:      normalized,
+				MaxDepth: e.MaxDepth,
+				Scope:    e.Scope,
+				Priority: e.Priority,
+				Delay:    e.Delay.Duration,
+				Tags:     e.Tags,
+			}
+		}
+		loaded++
+		if f.Push(c) {
+			added++
+		}
+	}
+
+	if loaded == 0 {
+		return ErrNoSeeds
+	}
+	if added == 0 {
+		// a shared frontier remembers the seeds of earlier crawls
+		slog.Warn("every seed was already seen, crawling what is left in the frontier", slog.Int("seeds", loaded))
+		return nil
+	}
+
+	slog.Info("loaded seeds", "count", added)
+	return nil
+}
+
+func readTextSeeds(path string) ([]seedEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
+	var entries []seedEntry
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		url := scanner.Text()
-		normalized, err := process.Normalize(url)
-		if err != nil {
-			slog.Error("couldn't normalize seed", slog.String("seed", url), slog.Any("err", err))
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		f.Push(normalized, url, "")
+		entries = append(entries, seedEntry{URL: line})
 	}
 
-	if err := scanner.Err(); err != nil {
-		return err
+	return entries, scanner.Err()
+}
+
+// readJSONSeeds reads an array of seed objects.
+func readJSONSeeds(path string) ([]seedEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
 
-	if f.Len() == 0 {
-		return ErrNoSeeds
+	var entries []seedEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid seeds file %s: %w", path, err)
 	}
+	return entries, nil
+}
 
-	slog.Info("loaded seeds", "count", f.Len())
-	return nil
+// readTOMLSeeds reads a [[seeds]] array of tables.
+func readTOMLSeeds(path string) ([]seedEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Seeds []seedEntry `toml:"seeds"`
+	}
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid seeds file %s: %w", path, err)
+	}
+	return file.Seeds, nil
 }
@@ -0,0 +1,156 @@
+package frontier
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/devraulu/crowlr/pkg/config"
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+// SeenSet remembers every URL the frontier has accepted, so each is queued
+// at most once per crawl. Seen-sets that implement encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler are saved in frontier snapshots.
+type SeenSet interface {
+	// Add records url and reports whether it was new.
+	Add(url string) (bool, error)
+	Close() error
+}
+
+// NewSeenSet builds the seen-set described by frontier.seen. With resume
+// set, a disk seen-set keeps the URLs of the crawl being resumed.
+func NewSeenSet(cfg config.SeenConfig, resume bool) (SeenSet, error) {
+	switch cfg.Type {
+	case "", "memory":
+		return NewMemorySeenSet(), nil
+	case "bloom":
+		return NewBloomSeenSet(cfg.Capacity, cfg.FalsePositiveRate), nil
+	case "disk":
+		return OpenDiskSeenSet(cfg.Path, resume)
+	default:
+		return nil, fmt.Errorf("unknown seen-set type %q", cfg.Type)
+	}
+}
+
+// MemorySeenSet keeps every URL in a map. It is exact but grows with the
+// crawl.
+type MemorySeenSet struct {
+	mu   sync.Mutex
+	urls map[string]struct{}
+}
+
+func NewMemorySeenSet() *MemorySeenSet {
+	return &MemorySeenSet{urls: make(map[string]struct{})}
+}
+
+func (s *MemorySeenSet) Add(url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[url]; ok {
+		return false, nil
+	}
+	s.urls[url] = struct{}{}
+	return true, nil
+}
+
+func (s *MemorySeenSet) Close() error {
+	return nil
+}
+
+func (s *MemorySeenSet) MarshalBinary() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls := make([]string, 0, len(s.urls))
+	for u := range s.urls {
+		urls = append(urls, u)
+	}
+	return gobEncode(urls)
+}
+
+func (s *MemorySeenSet) UnmarshalBinary(data []byte) error {
+	var urls []string
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&urls); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range urls {
+		s.urls[u] = struct{}{}
+	}
+	return nil
+}
+
+var seenBucket = []byte("seen")
+
+// DiskSeenSet keeps URLs in a bbolt file, so memory use stays flat however
+// many URLs are discovered. As the file outlives the crawl, it isn't saved in
+// snapshots.
+type DiskSeenSet struct {
+	db *bolt.DB
+}
+
+// OpenDiskSeenSet opens the set at path, emptied unless keep is set.
+func OpenDiskSeenSet(path string, keep bool) (*DiskSeenSet, error) {
+	db, err := bolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if keep {
+			_, err := tx.CreateBucketIfNotExists(seenBucket)
+			return err
+		}
+		if err := tx.DeleteBucket(seenBucket); err != nil && !errors.Is(err, bolterrors.ErrBucketNotFound) {
+			return err
+		}
+		_, err := tx.CreateBucket(seenBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// every Add is its own transaction; losing the tail of the set in a
+	// crash only means a few URLs are crawled again
+	db.NoSync = true
+
+	return &DiskSeenSet{db: db}, nil
+}
+
+func (s *DiskSeenSet) Add(url string) (bool, error) {
+	added := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(seenBucket)
+		if b.Get([]byte(url)) != nil {
+			return nil
+		}
+		added = true
+		return b.Put([]byte(url), []byte{})
+	})
+	return added, err
+}
+
+func (s *DiskSeenSet) Close() error {
+	if err := s.db.Sync(); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
+
+func gobEncode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
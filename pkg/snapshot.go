@@ -0,0 +1,163 @@
+package frontier
+
+import (
+	"encoding"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// snapshotHeader starts a snapshot file, followed by one snapshotEntry per
+// queued URL.
+type snapshotHeader struct {
+	// Seen is the seen-set, nil if it can't be saved
+	Seen []byte
+	// State is what the crawler saved alongside the frontier
+	State []byte
+}
+
+// snapshotEntry is one queued URL in a snapshot file.
+type snapshotEntry struct {
+	Candidate Candidate
+	Front     bool
+}
+
+// Snapshot writes every queued URL to path, spilled ones included, so a
+// drained crawl can pick up where it stopped. The seen-set is saved too when
+// it supports it, along with state, which RestoreSnapshot hands back. The
+// file is replaced atomically. It returns how many URLs were written.
+func (f *Frontier) Snapshot(path string, state []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	header := snapshotHeader{State: state}
+	if m, ok := f.seen.(encoding.BinaryMarshaler); ok {
+		seen, err := m.MarshalBinary()
+		if err != nil {
+			return 0, fmt.Errorf("seen-set: %w", err)
+		}
+		header.Seen = seen
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := gob.NewEncoder(tmp)
+	if err := enc.Encode(header); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	n := 0
+	write := func(it *item) error {
+		n++
+		return enc.Encode(snapshotEntry{Candidate: it.Candidate, Front: it.front})
+	}
+
+	for _, hq := range f.queues {
+		for _, it := range hq.items {
+			if err := write(it); err != nil {
+				tmp.Close()
+				return 0, err
+			}
+		}
+		for _, seg := range hq.segments {
+			records, err := decodeSegment(seg.path)
+			if err != nil {
+				slog.Error("frontier segment unreadable, leaving it out of the snapshot", slog.String("host", hq.Host), slog.String("path", seg.path), slog.Any("err", err))
+				continue
+			}
+			for _, r := range records {
+				if err := write(&item{Candidate: r.Candidate}); err != nil {
+					tmp.Close()
+					return 0, err
+				}
+			}
+		}
+		for _, it := range hq.pending {
+			if err := write(it); err != nil {
+				tmp.Close()
+				return 0, err
+			}
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
+
+// RestoreSnapshot loads the seen-set and queues the URLs saved by Snapshot,
+// then removes the file. It returns how many URLs were queued and the
+// crawler's saved state. A missing file restores nothing.
+func (f *Frontier) RestoreSnapshot(path string) (int, []byte, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	dec := gob.NewDecoder(file)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return 0, nil, err
+	}
+	if u, ok := f.seen.(encoding.BinaryUnmarshaler); ok && header.Seen != nil {
+		if err := u.UnmarshalBinary(header.Seen); err != nil {
+			return 0, nil, fmt.Errorf("seen-set: %w", err)
+		}
+	}
+
+	n := 0
+	for {
+		var e snapshotEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return n, nil, err
+		}
+
+		if f.restore(e.Candidate, e.Front) {
+			n++
+		}
+	}
+
+	file.Close()
+	return n, header.State, os.Remove(path)
+}
+
+// restore queues a URL of a snapshot. Unlike push, it queues URLs the
+// restored seen-set already holds.
+func (f *Frontier) restore(c Candidate, front bool) bool {
+	if c.Group == "" {
+		group, err := f.key.Group(c.Normalized)
+		if err != nil {
+			return false
+		}
+		c.Group = group
+	}
+	if _, err := f.seen.Add(c.Normalized); err != nil {
+		slog.Error("frontier seen-set failed", slog.String("url", c.Normalized), slog.Any("err", err))
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.queued[c.Normalized]; ok {
+		return false
+	}
+	f.add(c.Group, c, front)
+	return true
+}
@@ -0,0 +1,196 @@
+package frontier
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// spill moves the tail of large host queues to segment files, keeping at
+// most limit URLs per host in memory. URLs that arrive while a queue's head
+// is full are buffered and written out segSize at a time; segments are read
+// back oldest first as the head drains. Ordering by score is only kept within
+// the in-memory head.
+type spill struct {
+	// parent is where the per-crawl directory is created, "" for the
+	// system temp directory
+	parent  string
+	dir     string
+	limit   int
+	segSize int
+	nextSeg int
+}
+
+// spilledItem is the on-disk form of a queued item.
+type spilledItem struct {
+	Candidate Candidate
+	Score     float64
+	Seq       uint64
+}
+
+// WithSpill keeps at most limit URLs per host in memory and spills the rest
+// to segment files of segmentSize URLs in a temporary directory under dir
+// ("" for the system temp directory). The directory is removed by Close.
+func WithSpill(dir string, limit, segmentSize int) Option {
+	return func(f *Frontier) {
+		f.spill = &spill{
+			parent:  dir,
+			limit:   limit,
+			segSize: segmentSize,
+		}
+	}
+}
+
+// enqueue adds it to the in-memory head of hq, or to its spill buffer once
+// the head is full. Items pushed to the front are never spilled.
+func (f *Frontier) enqueue(hq *HostQueue, it *item) {
+	if f.spill == nil || it.front || hq.items.Len() < f.spill.limit {
+		f.pushHead(hq, it)
+		return
+	}
+
+	hq.pending = append(hq.pending, it)
+	if len(hq.pending) >= f.spill.segSize {
+		f.flush(hq)
+	}
+}
+
+// dequeue pops the best item in the head of hq, first refilling the head
+// from disk when there is room for another segment. It returns nil if the
+// queue turned out to be empty because its segments were unreadable.
+func (f *Frontier) dequeue(hq *HostQueue) *item {
+	for f.spill != nil && hq.spilled() > 0 &&
+		(hq.items.Len() == 0 || hq.items.Len()+f.spill.segSize <= f.spill.limit) {
+		f.refill(hq)
+	}
+	if hq.items.Len() == 0 {
+		return nil
+	}
+
+	it := heap.Pop(&hq.items).(*item)
+	delete(f.queued, it.Normalized)
+	return it
+}
+
+func (f *Frontier) pushHead(hq *HostQueue, it *item) {
+	heap.Push(&hq.items, it)
+	f.queued[it.Normalized] = it
+}
+
+// flush writes the spill buffer of hq to a new segment. If that fails the
+// buffer is kept in memory instead.
+func (f *Frontier) flush(hq *HostQueue) {
+	path, err := f.spill.write(hq.pending)
+	if err != nil {
+		slog.Error("frontier spill failed, keeping queue in memory", slog.String("host", hq.Host), slog.Any("err", err))
+		for _, it := range hq.pending {
+			f.pushHead(hq, it)
+		}
+		hq.pending = nil
+		return
+	}
+
+	slog.Debug("frontier spilled segment", slog.String("host", hq.Host), slog.String("path", path), slog.Int("urls", len(hq.pending)))
+	hq.segments = append(hq.segments, segment{path: path, count: len(hq.pending)})
+	hq.pending = nil
+}
+
+// refill moves the oldest segment of hq, or its spill buffer when no segment
+// is left, into the in-memory head.
+func (f *Frontier) refill(hq *HostQueue) {
+	if len(hq.segments) == 0 {
+		for _, it := range hq.pending {
+			f.pushHead(hq, it)
+		}
+		hq.pending = nil
+		return
+	}
+
+	seg := hq.segments[0]
+	hq.segments = hq.segments[1:]
+
+	items, err := readSegment(seg.path)
+	if err != nil {
+		// the URLs are lost; keep the count honest
+		slog.Error("frontier segment unreadable, dropping it", slog.String("host", hq.Host), slog.String("path", seg.path), slog.Int("urls", seg.count), slog.Any("err", err))
+		f.count -= seg.count
+		return
+	}
+
+	for _, it := range items {
+		it.host = hq.Host
+		f.pushHead(hq, it)
+	}
+}
+
+func (s *spill) write(items []*item) (string, error) {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp(s.parent, "crowlr-frontier-")
+		if err != nil {
+			return "", err
+		}
+		s.dir = dir
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%08d.seg", s.nextSeg))
+	s.nextSeg++
+
+	records := make([]spilledItem, len(items))
+	for i, it := range items {
+		records[i] = spilledItem{Candidate: it.Candidate, Score: it.score, Seq: it.seq}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := gob.NewEncoder(file).Encode(records); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func readSegment(path string) ([]*item, error) {
+	defer os.Remove(path)
+
+	records, err := decodeSegment(path)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*item, len(records))
+	for i, r := range records {
+		items[i] = &item{Candidate: r.Candidate, score: r.Score, seq: r.Seq}
+	}
+	return items, nil
+}
+
+func decodeSegment(path string) ([]spilledItem, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []spilledItem
+	if err := gob.NewDecoder(file).Decode(&records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *spill) close() error {
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// flushTimeout bounds how long one batch may take to write.
+const flushTimeout = time.Minute
+
+// ErrWriterClosed is returned by BatchWriter.SavePage after Close.
+var ErrWriterClosed = errors.New("batch writer closed")
+
+// BatchWriter is a Storage whose SavePage queues pages and returns straight
+// away. A background goroutine writes them with SavePages once size pages
+// are waiting or interval has passed, whichever comes first. When a batch is
+// still being written and size more pages are waiting, SavePage blocks until
+// there is room. All other methods go straight to the wrapped Storage.
+//
+// A batch that fails is retried one page at a time so a single bad page
+// doesn't lose the others. SavePage can't return the errors of a later
+// write, so each page's outcome is passed to the written callback instead,
+// nil once it is stored.
+type BatchWriter struct {
+	Storage
+
+	size     int
+	interval time.Duration
+	pages    chan Page
+	written  func(p Page, err error)
+
+	// mu keeps SavePage from sending once Close has started
+	mu     sync.RWMutex
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewBatchWriter starts a writer for s. written is called from the writer's
+// goroutine after each page is written or given up on; it may be nil.
+func NewBatchWriter(s Storage, size int, interval time.Duration, written func(p Page, err error)) *BatchWriter {
+	if written == nil {
+		written = func(Page, error) {}
+	}
+	w := &BatchWriter{
+		Storage:  s,
+		size:     size,
+		interval: interval,
+		written:  written,
+		pages:    make(chan Page, size),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// SavePage queues p for the next batch. It blocks while the queue is full,
+// until ctx is done.
+func (w *BatchWriter) SavePage(ctx context.Context, p Page) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	select {
+	case w.pages <- p:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes the queued pages and stops the writer once their outcomes
+// have been passed to written. The wrapped Storage stays open.
+func (w *BatchWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]Page, 0, w.size)
+	for {
+		select {
+		case p := <-w.pages:
+			batch = append(batch, p)
+			if len(batch) < w.size {
+				continue
+			}
+		case <-ticker.C:
+		case <-w.stop:
+			// nothing is sent once stop is closed
+			for len(w.pages) > 0 {
+				batch = append(batch, <-w.pages)
+			}
+			w.flush(batch)
+			return
+		}
+
+		w.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (w *BatchWriter) flush(batch []Page) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := w.Storage.SavePages(ctx, batch)
+	if err == nil {
+		slog.Debug("flushed pages", slog.Int("count", len(batch)), slog.Duration("took", time.Since(start)))
+		for _, p := range batch {
+			w.written(p, nil)
+		}
+		return
+	}
+
+	slog.Warn("batch write failed, saving pages one at a time", slog.Int("count", len(batch)), slog.Any("err", err))
+	ctx, cancel = context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	failed := 0
+	for _, p := range batch {
+		err := w.Storage.SavePage(ctx, p)
+		if err != nil {
+			failed++
+			slog.Error("failed to save page", slog.String("url", p.URL), slog.Any("err", err))
+		}
+		w.written(p, err)
+	}
+	if failed > 0 {
+		slog.Error("pages lost", slog.Int("count", failed))
+	}
+}
@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"context"
+	"html"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/devraulu/crowlr/pkg/lang"
+)
+
+// memorySnippetWords is how many words of content a search snippet shows.
+const memorySnippetWords = 30
+
+// MemoryStorage keeps everything in memory, for tests and throwaway crawls.
+// Search matches pages containing every query term, with no stemming.
+type MemoryStorage struct {
+	mu          sync.Mutex
+	pages       []Page
+	sitemaps    map[string]Sitemap
+	feeds       []Feed
+	cutoffs     map[string]Cutoff
+	quarantines []Quarantine
+	commands    []Command
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		sitemaps: make(map[string]Sitemap),
+		cutoffs:  make(map[string]Cutoff),
+	}
+}
+
+func (s *MemoryStorage) SavePage(ctx context.Context, p Page) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.ID = strconv.Itoa(len(s.pages) + 1)
+	p.ContentType = contentType(p)
+	s.pages = append(s.pages, p)
+	return nil
+}
+
+func (s *MemoryStorage) SavePages(ctx context.Context, pages []Page) error {
+	for _, p := range pages {
+		if err := s.SavePage(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pages returns the saved pages in the order they were saved.
+func (s *MemoryStorage) Pages() []Page {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Page(nil), s.pages...)
+}
+
+func (s *MemoryStorage) SaveSitemap(ctx context.Context, sm Sitemap) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sitemaps[sm.URL] = sm
+	return nil
+}
+
+func (s *MemoryStorage) SaveFeed(ctx context.Context, f Feed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.feeds {
+		if existing.URL == f.URL {
+			return nil
+		}
+	}
+	s.feeds = append(s.feeds, Feed{
+		ID:           len(s.feeds) + 1,
+		URL:          f.URL,
+		SiteURL:      f.SiteURL,
+		Title:        f.Title,
+		DiscoveredAt: time.Now(),
+	})
+	return nil
+}
+
+func (s *MemoryStorage) DueFeeds(ctx context.Context, polledBefore time.Time, limit int) ([]Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Feed
+	for _, f := range s.feeds {
+		if f.LastPolled == nil || f.LastPolled.Before(polledBefore) {
+			due = append(due, f)
+		}
+	}
+	// never polled first, then least recently polled
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := due[i].LastPolled, due[j].LastPolled
+		return a == nil && b != nil || a != nil && b != nil && a.Before(*b)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *MemoryStorage) UpdateFeed(ctx context.Context, f Feed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.feeds {
+		existing := &s.feeds[i]
+		if existing.URL != f.URL {
+			continue
+		}
+		if f.Title != "" {
+			existing.Title = f.Title
+		}
+		existing.LastPolled = f.LastPolled
+		existing.LastEntryAt = f.LastEntryAt
+		existing.ETag = f.ETag
+		existing.LastModified = f.LastModified
+		existing.StatusCode = f.StatusCode
+		existing.ErrorCount = f.ErrorCount
+	}
+	return nil
+}
+
+func (s *MemoryStorage) SaveCutoff(ctx context.Context, c Cutoff) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cutoffs[c.Host] = c
+	return nil
+}
+
+func (s *MemoryStorage) SaveQuarantine(ctx context.Context, q Quarantine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.quarantines {
+		if existing.Host == q.Host && existing.Pattern == q.Pattern {
+			return nil
+		}
+	}
+	s.quarantines = append(s.quarantines, q)
+	return nil
+}
+
+func (s *MemoryStorage) Quarantines(ctx context.Context) ([]Quarantine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	qs := append([]Quarantine(nil), s.quarantines...)
+	sort.SliceStable(qs, func(i, j int) bool {
+		return qs[i].QuarantinedAt.After(qs[j].QuarantinedAt)
+	})
+	return qs, nil
+}
+
+func (s *MemoryStorage) SaveCommand(ctx context.Context, kind, arg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, Command{
+		ID:        int64(len(s.commands) + 1),
+		Kind:      kind,
+		Arg:       arg,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (s *MemoryStorage) Commands(ctx context.Context, afterID int64) ([]Command, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if afterID >= int64(len(s.commands)) {
+		return nil, nil
+	}
+	return append([]Command(nil), s.commands[max(afterID, 0):]...), nil
+}
+
+func (s *MemoryStorage) LastCommandID(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.commands)), nil
+}
+
+// Search returns the pages containing every word of query, case-insensitively,
+// ranked by how often the words occur with title matches counting most. A
+// given language limits the results to pages in that language.
+func (s *MemoryStorage) Search(ctx context.Context, query, language string, limit int) (SearchResponse, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return SearchResponse{}, nil
+	}
+
+	filter := ""
+	if language != "" {
+		filter = TextSearchConfig(language)
+	}
+	tsConfig := filter
+	if tsConfig == "" {
+		if detected := lang.Detect(query); detected != "" {
+			tsConfig = TextSearchConfig(detected)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []SearchResult
+	for _, p := range s.pages {
+		if filter != "" && TextSearchConfig(p.Language) != filter {
+			continue
+		}
+		rank, ok := termRank(p, terms)
+		if !ok {
+			continue
+		}
+
+		body := p.MainContent
+		if body == "" {
+			body = p.Content
+		}
+		results = append(results, SearchResult{
+			URL:         p.URL,
+			Title:       p.Title,
+			Snippet:     termSnippet(body, terms),
+			Rank:        rank,
+			Fields:      p.Fields,
+			Language:    p.Language,
+			PublishedAt: p.PublishedAt,
+			ContentType: p.ContentType,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Rank > results[j].Rank
+	})
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	slog.Info("search complete", "query", query, "ts_config", tsConfig, "results", len(results), "total", total)
+	return SearchResponse{
+		Results:    results,
+		TotalCount: total,
+		Language:   tsConfig,
+	}, nil
+}
+
+// searchTerms splits text into lowercase words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// termRank scores p by the occurrences of terms in its title, its
+// description, headings, keywords, url and fields, its main content and its
+// full text, weighted in that order. It reports false when a term is missing.
+func termRank(p Page, terms []string) (float64, bool) {
+	meta := []string{p.Description, p.URL}
+	meta = append(meta, p.Headings...)
+	meta = append(meta, p.Keywords...)
+	for _, v := range p.Fields {
+		meta = append(meta, v)
+	}
+
+	columns := []struct {
+		words  []string
+		weight float64
+	}{
+		{searchTerms(p.Title), 1.0},
+		{searchTerms(strings.Join(meta, " ")), 0.4},
+		{searchTerms(p.MainContent), 0.2},
+		{searchTerms(p.Content), 0.1},
+	}
+
+	rank := 0.0
+	for _, term := range terms {
+		found := false
+		for _, col := range columns {
+			for _, w := range col.words {
+				if w == term {
+					rank += col.weight
+					found = true
+				}
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// termSnippet returns the words of text around the first query term, with the
+// terms wrapped in <mark> and the rest HTML-escaped.
+func termSnippet(text string, terms []string) string {
+	words := strings.Fields(text)
+	isTerm := func(word string) bool {
+		for _, w := range searchTerms(word) {
+			for _, t := range terms {
+				if w == t {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	start := 0
+	for i, w := range words {
+		if isTerm(w) {
+			start = max(i-memorySnippetWords/3, 0)
+			break
+		}
+	}
+	end := min(start+memorySnippetWords, len(words))
+
+	var b strings.Builder
+	for i, w := range words[start:end] {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if isTerm(w) {
+			b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(w))
+		}
+	}
+	return b.String()
+}
+
+func (s *MemoryStorage) EachPage(ctx context.Context, fn func(Page) error) error {
+	for _, p := range s.Pages() {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Stats(ctx context.Context) (Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Stats{
+		Pages:    len(s.pages),
+		Sitemaps: len(s.sitemaps),
+		Feeds:    len(s.feeds),
+	}
+
+	hosts := make(map[string]bool)
+	codes := make(map[int]int)
+	for _, p := range s.pages {
+		if u, err := url.Parse(p.URL); err == nil {
+			hosts[u.Hostname()] = true
+		}
+		codes[p.StatusCode]++
+		if st.FirstCrawled == nil || p.Timestamp.Before(*st.FirstCrawled) {
+			t := p.Timestamp
+			st.FirstCrawled = &t
+		}
+		if st.LastCrawled == nil || p.Timestamp.After(*st.LastCrawled) {
+			t := p.Timestamp
+			st.LastCrawled = &t
+		}
+	}
+	st.Hosts = len(hosts)
+
+	for code, n := range codes {
+		st.StatusCodes = append(st.StatusCodes, StatusCount{StatusCode: code, Count: n})
+	}
+	sort.Slice(st.StatusCodes, func(i, j int) bool {
+		return st.StatusCodes[i].StatusCode < st.StatusCodes[j].StatusCode
+	})
+
+	for _, c := range s.cutoffs {
+		st.Cutoffs = append(st.Cutoffs, c)
+	}
+	sort.Slice(st.Cutoffs, func(i, j int) bool {
+		return st.Cutoffs[i].CutAt.After(st.Cutoffs[j].CutAt)
+	})
+	if len(st.Cutoffs) > statsCutoffs {
+		st.Cutoffs = st.Cutoffs[:statsCutoffs]
+	}
+
+	return st, nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
@@ -8,29 +8,60 @@ import (
 	"log/slog"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
 //go:embed all:migrations/*.sql
 var migrationsFS embed.FS
 
-func RunMigrations(db *sql.DB) error {
-	sourceDriver, err := iofs.New(migrationsFS, "migrations")
+// SQLite has its own schema, started afresh rather than translated step by
+// step from the Postgres one.
+//
+//go:embed all:migrations/sqlite/*.sql
+var sqliteMigrationsFS embed.FS
+
+// newMigrate picks the migrations and driver matching the database db was
+// opened for.
+func newMigrate(db *sql.DB) (*migrate.Migrate, error) {
+	dir, name := "migrations", "postgres"
+	fsys := migrationsFS
+	if isSQLite(db) {
+		dir, name = "migrations/sqlite", "sqlite"
+		fsys = sqliteMigrationsFS
+	}
+
+	sourceDriver, err := iofs.New(fsys, dir)
 	if err != nil {
-		return fmt.Errorf("could not create source driver: %w", err)
+		return nil, fmt.Errorf("could not create source driver: %w", err)
 	}
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	var driver database.Driver
+	if isSQLite(db) {
+		driver, err = sqlite.WithInstance(db, &sqlite.Config{})
+	} else {
+		driver, err = postgres.WithInstance(db, &postgres.Config{})
+	}
 	if err != nil {
-		return fmt.Errorf("could not create migration driver: %w", err)
+		return nil, fmt.Errorf("could not create migration driver: %w", err)
 	}
 
 	m, err := migrate.NewWithInstance(
 		"iofs", sourceDriver,
-		"postgres", driver)
+		name, driver)
+	if err != nil {
+		return nil, fmt.Errorf("could not create migrate instance: %w", err)
+	}
+
+	return m, nil
+}
+
+func RunMigrations(db *sql.DB) error {
+	m, err := newMigrate(db)
 	if err != nil {
-		return fmt.Errorf("could not create migrate instance: %w", err)
+		return err
 	}
 
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
@@ -40,3 +71,37 @@ func RunMigrations(db *sql.DB) error {
 	slog.Info("migrations ran successfully")
 	return nil
 }
+
+// RollbackMigrations reverts the given number of applied migrations.
+func RollbackMigrations(db *sql.DB, steps int) error {
+	m, err := newMigrate(db)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("could not run down migrations: %w", err)
+	}
+
+	slog.Info("migrations rolled back", "steps", steps)
+	return nil
+}
+
+// MigrationStatus reports the current schema version. A version of 0 means
+// no migration has been applied yet.
+func MigrationStatus(db *sql.DB) (version uint, dirty bool, err error) {
+	m, err := newMigrate(db)
+	if err != nil {
+		return 0, false, err
+	}
+
+	version, dirty, err = m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read migration version: %w", err)
+	}
+
+	return version, dirty, nil
+}
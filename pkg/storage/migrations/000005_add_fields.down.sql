@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS fields_idx;
+DROP INDEX IF EXISTS textsearch_idx;
+ALTER TABLE pages DROP COLUMN IF EXISTS textsearch;
+
+ALTER TABLE pages DROP COLUMN IF EXISTS fields;
+
+ALTER TABLE pages
+    ADD COLUMN textsearch tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(url, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'C')
+    ) STORED;
+
+CREATE INDEX textsearch_idx ON pages USING GIN (textsearch);
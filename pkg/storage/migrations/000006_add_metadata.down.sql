@@ -0,0 +1,22 @@
+DROP INDEX IF EXISTS published_at_idx;
+DROP INDEX IF EXISTS textsearch_idx;
+ALTER TABLE pages DROP COLUMN IF EXISTS textsearch;
+
+ALTER TABLE pages
+    DROP COLUMN IF EXISTS description,
+    DROP COLUMN IF EXISTS keywords,
+    DROP COLUMN IF EXISTS language,
+    DROP COLUMN IF EXISTS headings,
+    DROP COLUMN IF EXISTS published_at,
+    DROP COLUMN IF EXISTS metadata;
+
+ALTER TABLE pages
+    ADD COLUMN textsearch tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(url, '')), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(fields, '{}'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'C')
+    ) STORED;
+
+CREATE INDEX textsearch_idx ON pages USING GIN (textsearch);
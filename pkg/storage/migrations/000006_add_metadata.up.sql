@@ -0,0 +1,25 @@
+ALTER TABLE pages
+    ADD COLUMN description TEXT,
+    ADD COLUMN keywords JSONB,
+    ADD COLUMN language TEXT,
+    ADD COLUMN headings JSONB,
+    ADD COLUMN published_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN metadata JSONB;
+
+DROP INDEX IF EXISTS textsearch_idx;
+ALTER TABLE pages DROP COLUMN IF EXISTS textsearch;
+
+ALTER TABLE pages
+    ADD COLUMN textsearch tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(headings, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(keywords, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector('english', coalesce(url, '')), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(fields, '{}'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'C')
+    ) STORED;
+
+CREATE INDEX textsearch_idx ON pages USING GIN (textsearch);
+CREATE INDEX published_at_idx ON pages (published_at);
@@ -0,0 +1,19 @@
+ALTER TABLE pages ADD COLUMN main_content TEXT;
+
+DROP INDEX IF EXISTS textsearch_idx;
+ALTER TABLE pages DROP COLUMN IF EXISTS textsearch;
+
+ALTER TABLE pages
+    ADD COLUMN textsearch tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(headings, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(keywords, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector('english', coalesce(url, '')), 'B') ||
+        setweight(jsonb_to_tsvector('english', coalesce(fields, '{}'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector('english', coalesce(main_content, '')), 'C') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'D')
+    ) STORED;
+
+CREATE INDEX textsearch_idx ON pages USING GIN (textsearch);
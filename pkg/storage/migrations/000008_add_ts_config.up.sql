@@ -0,0 +1,56 @@
+DROP INDEX IF EXISTS textsearch_idx;
+ALTER TABLE pages DROP COLUMN IF EXISTS textsearch;
+
+ALTER TABLE pages ADD COLUMN ts_config regconfig NOT NULL DEFAULT 'simple';
+
+UPDATE pages SET ts_config = CASE lower(split_part(replace(coalesce(language, ''), '_', '-'), '-', 1))
+    WHEN 'ar' THEN 'arabic'
+    WHEN 'hy' THEN 'armenian'
+    WHEN 'eu' THEN 'basque'
+    WHEN 'ca' THEN 'catalan'
+    WHEN 'da' THEN 'danish'
+    WHEN 'nl' THEN 'dutch'
+    WHEN 'en' THEN 'english'
+    WHEN 'fi' THEN 'finnish'
+    WHEN 'fr' THEN 'french'
+    WHEN 'de' THEN 'german'
+    WHEN 'el' THEN 'greek'
+    WHEN 'hi' THEN 'hindi'
+    WHEN 'hu' THEN 'hungarian'
+    WHEN 'id' THEN 'indonesian'
+    WHEN 'ga' THEN 'irish'
+    WHEN 'it' THEN 'italian'
+    WHEN 'lt' THEN 'lithuanian'
+    WHEN 'ne' THEN 'nepali'
+    WHEN 'no' THEN 'norwegian'
+    WHEN 'nb' THEN 'norwegian'
+    WHEN 'nn' THEN 'norwegian'
+    WHEN 'pt' THEN 'portuguese'
+    WHEN 'ro' THEN 'romanian'
+    WHEN 'ru' THEN 'russian'
+    WHEN 'sr' THEN 'serbian'
+    WHEN 'es' THEN 'spanish'
+    WHEN 'sv' THEN 'swedish'
+    WHEN 'ta' THEN 'tamil'
+    WHEN 'tr' THEN 'turkish'
+    WHEN 'yi' THEN 'yiddish'
+    -- pages crawled before language detection were indexed as English
+    WHEN '' THEN 'english'
+    ELSE 'simple'
+END::regconfig;
+
+ALTER TABLE pages
+    ADD COLUMN textsearch tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector(ts_config, coalesce(title, '')), 'A') ||
+        setweight(to_tsvector(ts_config, coalesce(description, '')), 'B') ||
+        setweight(jsonb_to_tsvector(ts_config, coalesce(headings, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(jsonb_to_tsvector(ts_config, coalesce(keywords, '[]'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector(ts_config, coalesce(url, '')), 'B') ||
+        setweight(jsonb_to_tsvector(ts_config, coalesce(fields, '{}'::jsonb), '["string"]'), 'B') ||
+        setweight(to_tsvector(ts_config, coalesce(main_content, '')), 'C') ||
+        setweight(to_tsvector(ts_config, coalesce(content, '')), 'D')
+    ) STORED;
+
+CREATE INDEX textsearch_idx ON pages USING GIN (textsearch);
+CREATE INDEX ts_config_idx ON pages (ts_config);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS content_type_idx;
+
+ALTER TABLE pages DROP COLUMN IF EXISTS content_type;
@@ -0,0 +1,3 @@
+ALTER TABLE pages ADD COLUMN content_type TEXT NOT NULL DEFAULT 'text/html';
+
+CREATE INDEX content_type_idx ON pages (content_type);
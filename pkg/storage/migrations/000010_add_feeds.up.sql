@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS feeds (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    site_url TEXT,
+    title TEXT,
+    discovered_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_polled TIMESTAMP WITH TIME ZONE,
+    last_entry_at TIMESTAMP WITH TIME ZONE,
+    etag TEXT,
+    last_modified TEXT,
+    status_code INTEGER,
+    error_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX feeds_last_polled_idx ON feeds (last_polled NULLS FIRST);
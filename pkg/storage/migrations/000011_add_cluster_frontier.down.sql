@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS frontier_urls;
+DROP TABLE IF EXISTS frontier_hosts;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS frontier_hosts (
+    host TEXT PRIMARY KEY,
+    next_visit TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    queued INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX frontier_hosts_ready_idx ON frontier_hosts (next_visit) WHERE queued > 0;
+
+CREATE TABLE IF NOT EXISTS frontier_urls (
+    id BIGSERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    original_url TEXT,
+    referrer TEXT,
+    host TEXT NOT NULL,
+    depth INTEGER NOT NULL DEFAULT 0,
+    priority DOUBLE PRECISION NOT NULL DEFAULT 0,
+    score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    state TEXT NOT NULL DEFAULT 'queued',
+    claimed_by TEXT,
+    claimed_at TIMESTAMP WITH TIME ZONE,
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX frontier_urls_queued_idx ON frontier_urls (host, score DESC, id) WHERE state = 'queued';
+CREATE INDEX frontier_urls_claimed_idx ON frontier_urls (claimed_at) WHERE state = 'claimed';
@@ -0,0 +1,5 @@
+ALTER TABLE frontier_hosts
+    DROP COLUMN IF EXISTS delay,
+    DROP COLUMN IF EXISTS latency,
+    DROP COLUMN IF EXISTS error_rate,
+    DROP COLUMN IF EXISTS samples;
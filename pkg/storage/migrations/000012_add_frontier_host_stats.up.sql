@@ -0,0 +1,5 @@
+ALTER TABLE frontier_hosts
+    ADD COLUMN delay DOUBLE PRECISION,
+    ADD COLUMN latency DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN error_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN samples INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS host_cutoffs (
+    host TEXT PRIMARY KEY,
+    reason TEXT NOT NULL,
+    pages INTEGER NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    cut_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS quarantined_patterns (
+    id SERIAL PRIMARY KEY,
+    host TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    example TEXT NOT NULL,
+    urls INTEGER NOT NULL DEFAULT 0,
+    quarantined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (host, pattern)
+);
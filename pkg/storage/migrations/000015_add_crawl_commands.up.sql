@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS crawl_commands (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL CHECK (kind IN ('seed', 'block')),
+    arg TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+ALTER TABLE frontier_urls DROP COLUMN IF EXISTS seed;
+
+DROP INDEX IF EXISTS tags_idx;
+ALTER TABLE pages DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,5 @@
+ALTER TABLE pages ADD COLUMN tags JSONB;
+
+CREATE INDEX tags_idx ON pages USING GIN (tags jsonb_path_ops);
+
+ALTER TABLE frontier_urls ADD COLUMN seed JSONB;
@@ -0,0 +1 @@
+ALTER TABLE frontier_hosts DROP COLUMN IF EXISTS min_delay;
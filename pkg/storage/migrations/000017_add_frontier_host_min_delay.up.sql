@@ -0,0 +1,3 @@
+ALTER TABLE frontier_hosts ADD COLUMN min_delay DOUBLE PRECISION;
+
+UPDATE frontier_hosts SET min_delay = delay WHERE samples = 0 AND delay IS NOT NULL;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS crawl_commands;
+DROP TABLE IF EXISTS quarantined_patterns;
+DROP TABLE IF EXISTS host_cutoffs;
+DROP TABLE IF EXISTS feeds;
+DROP TABLE IF EXISTS sitemaps;
+DROP TRIGGER IF EXISTS pages_fts_update;
+DROP TRIGGER IF EXISTS pages_fts_delete;
+DROP TRIGGER IF EXISTS pages_fts_insert;
+DROP TABLE IF EXISTS pages_fts;
+DROP TABLE IF EXISTS pages;
@@ -0,0 +1,125 @@
+-- Times are stored as unix nanoseconds, see OpenDB.
+CREATE TABLE IF NOT EXISTS pages (
+    id INTEGER PRIMARY KEY,
+    url TEXT NOT NULL,
+    normalized_url TEXT NOT NULL,
+    timestamp TIMESTAMP,
+    last_modified TIMESTAMP,
+    referrer TEXT,
+    title TEXT,
+    content TEXT,
+    html TEXT,
+    status_code INTEGER,
+    outlinks TEXT,
+    fields TEXT,
+    description TEXT,
+    keywords TEXT,
+    language TEXT,
+    headings TEXT,
+    published_at TIMESTAMP,
+    metadata TEXT,
+    main_content TEXT,
+    ts_config TEXT NOT NULL DEFAULT 'simple',
+    content_type TEXT NOT NULL DEFAULT 'text/html',
+    tags TEXT
+);
+
+CREATE INDEX ts_config_idx ON pages (ts_config);
+CREATE INDEX content_type_idx ON pages (content_type);
+
+-- Columns are weighted like the Postgres tsvector: title, then description,
+-- headings, keywords, url and fields, then main content, then full text.
+CREATE VIRTUAL TABLE pages_fts USING fts5(
+    title,
+    meta,
+    main_content,
+    content,
+    tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER pages_fts_insert AFTER INSERT ON pages BEGIN
+    INSERT INTO pages_fts (rowid, title, meta, main_content, content)
+    VALUES (
+        new.id,
+        new.title,
+        concat_ws(' ',
+            new.description,
+            (SELECT group_concat(value, ' ') FROM json_each(new.headings)),
+            (SELECT group_concat(value, ' ') FROM json_each(new.keywords)),
+            new.url,
+            (SELECT group_concat(value, ' ') FROM json_each(new.fields))),
+        new.main_content,
+        new.content
+    );
+END;
+
+CREATE TRIGGER pages_fts_delete AFTER DELETE ON pages BEGIN
+    DELETE FROM pages_fts WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER pages_fts_update AFTER UPDATE ON pages BEGIN
+    DELETE FROM pages_fts WHERE rowid = old.id;
+    INSERT INTO pages_fts (rowid, title, meta, main_content, content)
+    VALUES (
+        new.id,
+        new.title,
+        concat_ws(' ',
+            new.description,
+            (SELECT group_concat(value, ' ') FROM json_each(new.headings)),
+            (SELECT group_concat(value, ' ') FROM json_each(new.keywords)),
+            new.url,
+            (SELECT group_concat(value, ' ') FROM json_each(new.fields))),
+        new.main_content,
+        new.content
+    );
+END;
+
+CREATE TABLE IF NOT EXISTS sitemaps (
+    id INTEGER PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    last_checked TIMESTAMP,
+    status_code INTEGER,
+    content TEXT
+);
+
+CREATE TABLE IF NOT EXISTS feeds (
+    id INTEGER PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    site_url TEXT,
+    title TEXT,
+    discovered_at TIMESTAMP NOT NULL,
+    last_polled TIMESTAMP,
+    last_entry_at TIMESTAMP,
+    etag TEXT,
+    last_modified TEXT,
+    status_code INTEGER,
+    error_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX feeds_last_polled_idx ON feeds (last_polled);
+
+CREATE TABLE IF NOT EXISTS host_cutoffs (
+    host TEXT PRIMARY KEY,
+    reason TEXT NOT NULL,
+    pages INTEGER NOT NULL DEFAULT 0,
+    bytes INTEGER NOT NULL DEFAULT 0,
+    cut_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS quarantined_patterns (
+    id INTEGER PRIMARY KEY,
+    host TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    example TEXT NOT NULL,
+    urls INTEGER NOT NULL DEFAULT 0,
+    quarantined_at TIMESTAMP NOT NULL,
+    UNIQUE (host, pattern)
+);
+
+CREATE TABLE IF NOT EXISTS crawl_commands (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL CHECK (kind IN ('seed', 'block')),
+    arg TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// SQLiteScheme prefixes DSNs naming a SQLite database file, e.g.
+// sqlite://crowlr.db or sqlite:///var/lib/crowlr.db. Any other DSN is a
+// Postgres connection string.
+const SQLiteScheme = "sqlite://"
+
+// sqliteParams are added to every SQLite DSN. Times are stored as unix
+// nanoseconds so they sort and compare correctly, and read back as
+// time.Time from TIMESTAMP columns.
+const sqliteParams = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)" +
+	"&_time_integer_format=unix_nano&_inttotime=1"
+
+// OpenDB opens the database named by dsn.
+func OpenDB(dsn string) (*sql.DB, error) {
+	path, ok := strings.CutPrefix(dsn, SQLiteScheme)
+	if !ok {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open database: %w", err)
+		}
+		return db, nil
+	}
+
+	if path == "" {
+		return nil, fmt.Errorf("dsn %q has no database file", dsn)
+	}
+	path, query, _ := strings.Cut(path, "?")
+	if query != "" {
+		query = "&" + query
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+sqliteParams+query)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open database: %w", err)
+	}
+	// SQLite allows one writer at a time; a single connection queues writers
+	// in Go instead of failing them with SQLITE_BUSY, and keeps :memory:
+	// databases from being opened once per connection.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// New returns the Storage for a database opened with OpenDB.
+func New(db *sql.DB) Storage {
+	if isSQLite(db) {
+		return NewSQLiteStorage(db)
+	}
+	return NewPostgresStorage(db)
+}
+
+func isSQLite(db *sql.DB) bool {
+	_, ok := db.Driver().(*sqlite.Driver)
+	return ok
+}
@@ -4,9 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/devraulu/crowlr/pkg/lang"
 )
 
+// statsCutoffs is how many cut off hosts Stats lists.
+const statsCutoffs = 20
+
 type PostgresStorage struct {
 	db *sql.DB
 }
@@ -16,17 +25,18 @@ func NewPostgresStorage(db *sql.DB) *PostgresStorage {
 }
 
 func (s *PostgresStorage) SavePage(ctx context.Context, p Page) error {
-	jsonOutlinks, err := json.Marshal(p.Outlinks)
+	values, err := pageValues(p)
 	if err != nil {
 		return err
 	}
 
 	var id int
 	err = s.db.QueryRowContext(ctx, `
-		INSERT INTO pages (url, normalized_url, timestamp, title, content, html, status_code, outlinks, last_modified, referrer)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO pages (url, normalized_url, timestamp, title, content, html, status_code, outlinks, last_modified, referrer, fields,
+			description, keywords, language, headings, published_at, metadata, main_content, ts_config, content_type, tags)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19::regconfig, $20, $21)
 		RETURNING id`,
-		p.RawURL, p.URL, p.Timestamp, p.Title, p.Content, p.HTML, p.StatusCode, jsonOutlinks, p.LastModified, p.Referrer,
+		values...,
 	).Scan(&id)
 
 	if err != nil {
@@ -37,6 +47,98 @@ func (s *PostgresStorage) SavePage(ctx context.Context, p Page) error {
 	return nil
 }
 
+// SavePages stores pages with a single COPY, all or none of them.
+func (s *PostgresStorage) SavePages(ctx context.Context, pages []Page) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("pages", pageColumns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range pages {
+		values, err := pageValues(p)
+		if err != nil {
+			return err
+		}
+		// COPY would send []byte as bytea; the JSON columns want text
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("saved pages", slog.Int("count", len(pages)))
+	return nil
+}
+
+// pageColumns are the pages columns a Page is written to, in the order of
+// pageValues.
+var pageColumns = []string{
+	"url", "normalized_url", "timestamp", "title", "content", "html", "status_code", "outlinks", "last_modified", "referrer", "fields",
+	"description", "keywords", "language", "headings", "published_at", "metadata", "main_content", "ts_config", "content_type", "tags",
+}
+
+func pageValues(p Page) ([]any, error) {
+	jsonOutlinks, err := json.Marshal(p.Outlinks)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonFields, err := nullableJSON(p.Fields, len(p.Fields) == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonKeywords, err := nullableJSON(p.Keywords, len(p.Keywords) == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonHeadings, err := nullableJSON(p.Headings, len(p.Headings) == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonMetadata, err := nullableJSON(p.Metadata, p.Metadata.IsZero())
+	if err != nil {
+		return nil, err
+	}
+
+	jsonTags, err := nullableJSON(p.Tags, len(p.Tags) == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{
+		p.RawURL, p.URL, p.Timestamp, p.Title, p.Content, p.HTML, p.StatusCode, jsonOutlinks, p.LastModified, p.Referrer, jsonFields,
+		p.Description, jsonKeywords, p.Language, jsonHeadings, p.PublishedAt, jsonMetadata, p.MainContent, TextSearchConfig(p.Language), contentType(p), jsonTags,
+	}, nil
+}
+
 func (s *PostgresStorage) SaveSitemap(ctx context.Context, sm Sitemap) error {
 	var id int
 	err := s.db.QueryRowContext(ctx, `
@@ -56,16 +158,177 @@ func (s *PostgresStorage) SaveSitemap(ctx context.Context, sm Sitemap) error {
 	return nil
 }
 
-func (s *PostgresStorage) Search(ctx context.Context, query string, limit int) (SearchResponse, error) {
-	slog.Debug("search query", "query", query, "limit", limit)
+func (s *PostgresStorage) SaveFeed(ctx context.Context, f Feed) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO feeds (url, site_url, title)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (url) DO NOTHING`,
+		f.URL, f.SiteURL, f.Title,
+	)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("saved feed", "url", f.URL, "site_url", f.SiteURL)
+	}
+	return nil
+}
+
+func (s *PostgresStorage) DueFeeds(ctx context.Context, polledBefore time.Time, limit int) ([]Feed, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, url, COALESCE(site_url, ''), COALESCE(title, ''), discovered_at, last_polled, last_entry_at,
+			COALESCE(etag, ''), COALESCE(last_modified, ''), COALESCE(status_code, 0), error_count
+		FROM feeds
+		WHERE last_polled IS NULL OR last_polled < $1
+		ORDER BY last_polled NULLS FIRST
+		LIMIT $2`,
+		polledBefore, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for rows.Next() {
+		var f Feed
+		if err := rows.Scan(&f.ID, &f.URL, &f.SiteURL, &f.Title, &f.DiscoveredAt, &f.LastPolled, &f.LastEntryAt,
+			&f.ETag, &f.LastModified, &f.StatusCode, &f.ErrorCount); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+
+	return feeds, rows.Err()
+}
+
+func (s *PostgresStorage) UpdateFeed(ctx context.Context, f Feed) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE feeds
+		SET title = COALESCE(NULLIF($2, ''), title), last_polled = $3, last_entry_at = $4,
+			etag = $5, last_modified = $6, status_code = $7, error_count = $8
+		WHERE url = $1`,
+		f.URL, f.Title, f.LastPolled, f.LastEntryAt, f.ETag, f.LastModified, f.StatusCode, f.ErrorCount,
+	)
+	return err
+}
+
+func (s *PostgresStorage) SaveCutoff(ctx context.Context, c Cutoff) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO host_cutoffs (host, reason, pages, bytes, cut_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (host) DO UPDATE
+		SET reason = EXCLUDED.reason, pages = EXCLUDED.pages, bytes = EXCLUDED.bytes, cut_at = EXCLUDED.cut_at`,
+		c.Host, c.Reason, c.Pages, c.Bytes, c.CutAt,
+	)
+	return err
+}
+
+func (s *PostgresStorage) SaveQuarantine(ctx context.Context, q Quarantine) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO quarantined_patterns (host, pattern, reason, example, urls, quarantined_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (host, pattern) DO NOTHING`,
+		q.Host, q.Pattern, q.Reason, q.Example, q.URLs, q.QuarantinedAt,
+	)
+	return err
+}
+
+func (s *PostgresStorage) Quarantines(ctx context.Context) ([]Quarantine, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT host, pattern, reason, example, urls, quarantined_at
+		FROM quarantined_patterns
+		ORDER BY quarantined_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var qs []Quarantine
+	for rows.Next() {
+		var q Quarantine
+		if err := rows.Scan(&q.Host, &q.Pattern, &q.Reason, &q.Example, &q.URLs, &q.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		qs = append(qs, q)
+	}
+
+	return qs, rows.Err()
+}
+
+func (s *PostgresStorage) SaveCommand(ctx context.Context, kind, arg string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO crawl_commands (kind, arg) VALUES ($1, $2)`, kind, arg)
+	return err
+}
+
+func (s *PostgresStorage) Commands(ctx context.Context, afterID int64) ([]Command, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, kind, arg, created_at
+		FROM crawl_commands
+		WHERE id > $1
+		ORDER BY id`,
+		afterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cmds []Command
+	for rows.Next() {
+		var c Command
+		if err := rows.Scan(&c.ID, &c.Kind, &c.Arg, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c)
+	}
+
+	return cmds, rows.Err()
+}
+
+func (s *PostgresStorage) LastCommandID(ctx context.Context) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM crawl_commands`).Scan(&id)
+	return id, err
+}
+
+// Search matches query against pages in the given language, parsing it with
+// that language's text search configuration. An empty language is detected
+// from the query and only used to parse it: every page is matched, falling
+// back to the query parsed with the page's own configuration, as is done
+// when no language can be detected.
+func (s *PostgresStorage) Search(ctx context.Context, query, language string, limit int) (SearchResponse, error) {
+	slog.Debug("search query", "query", query, "language", language, "limit", limit)
+
+	tsConfig := ""
+	args := []any{query}
+	from := `pages, LATERAL websearch_to_tsquery(pages.ts_config, $1) query
+		WHERE textsearch @@ query`
+	switch {
+	case language != "":
+		tsConfig = TextSearchConfig(language)
+		args = append(args, tsConfig)
+		from = `pages, websearch_to_tsquery($2::regconfig, $1) query
+		WHERE ts_config = $2::regconfig AND textsearch @@ query`
+	case lang.Detect(query) != "":
+		tsConfig = TextSearchConfig(lang.Detect(query))
+		args = append(args, tsConfig)
+		from = `pages, LATERAL (
+			SELECT CASE WHEN textsearch @@ websearch_to_tsquery($2::regconfig, $1)
+				THEN websearch_to_tsquery($2::regconfig, $1)
+				ELSE websearch_to_tsquery(pages.ts_config, $1)
+			END AS query
+		) parsed
+		WHERE textsearch @@ query`
+	}
 
 	// Get total count first
 	var totalCount int
 	err := s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*)
-		FROM pages, websearch_to_tsquery('english', $1) query
-		WHERE textsearch @@ query`,
-		query,
+		FROM `+from,
+		args...,
 	).Scan(&totalCount)
 	if err != nil {
 		slog.Error("search count query failed", "query", query, "err", err)
@@ -73,17 +336,20 @@ func (s *PostgresStorage) Search(ctx context.Context, query string, limit int) (
 	}
 
 	// Get limited results
-	rows, err := s.db.QueryContext(ctx, `
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
 		SELECT
 			url,
 			COALESCE(title, ''),
-			ts_headline('english', COALESCE(content, ''), query, 'StartSel=<mark>, StopSel=</mark>, MaxWords=50, MinWords=25') AS snippet,
-			ts_rank_cd(textsearch, query, 32) AS rank
-		FROM pages, websearch_to_tsquery('english', $1) query
-		WHERE textsearch @@ query
+			ts_headline(ts_config, concat_ws(' ', NULLIF(description, ''), COALESCE(NULLIF(main_content, ''), content)), query, 'StartSel=`+markStart+`, StopSel=`+markStop+`, MaxWords=50, MinWords=25') AS snippet,
+			ts_rank_cd(textsearch, query, 32) AS rank,
+			fields,
+			COALESCE(language, ''),
+			published_at,
+			content_type
+		FROM %s
 		ORDER BY rank DESC
-		LIMIT $2`,
-		query, limit,
+		LIMIT $%d`, from, len(args)+1),
+		append(args, limit)...,
 	)
 	if err != nil {
 		slog.Error("search query failed", "query", query, "err", err)
@@ -94,10 +360,15 @@ func (s *PostgresStorage) Search(ctx context.Context, query string, limit int) (
 	var results []SearchResult
 	for rows.Next() {
 		var r SearchResult
-		if err := rows.Scan(&r.URL, &r.Title, &r.Snippet, &r.Rank); err != nil {
+		var jsonFields []byte
+		if err := rows.Scan(&r.URL, &r.Title, &r.Snippet, &r.Rank, &jsonFields, &r.Language, &r.PublishedAt, &r.ContentType); err != nil {
 			slog.Error("search scan failed", "query", query, "err", err)
 			return SearchResponse{}, err
 		}
+		if err := scanJSON(jsonFields, &r.Fields); err != nil {
+			return SearchResponse{}, err
+		}
+		r.Snippet = markedHTML(r.Snippet)
 		results = append(results, r)
 	}
 
@@ -106,13 +377,144 @@ func (s *PostgresStorage) Search(ctx context.Context, query string, limit int) (
 		return SearchResponse{}, err
 	}
 
-	slog.Info("search complete", "query", query, "results", len(results), "total", totalCount)
+	slog.Info("search complete", "query", query, "ts_config", tsConfig, "results", len(results), "total", totalCount)
 	return SearchResponse{
 		Results:    results,
 		TotalCount: totalCount,
+		Language:   tsConfig,
 	}, nil
 }
 
+func (s *PostgresStorage) EachPage(ctx context.Context, fn func(Page) error) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, url, normalized_url, timestamp, last_modified, COALESCE(referrer, ''),
+			COALESCE(title, ''), COALESCE(content, ''), COALESCE(html, ''), COALESCE(status_code, 0), outlinks, fields,
+			COALESCE(description, ''), keywords, COALESCE(language, ''), headings, published_at, metadata,
+			COALESCE(main_content, ''), content_type, tags
+		FROM pages
+		ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Page
+		var jsonOutlinks, jsonFields, jsonKeywords, jsonHeadings, jsonMetadata, jsonTags []byte
+		if err := rows.Scan(&p.ID, &p.RawURL, &p.URL, &p.Timestamp, &p.LastModified, &p.Referrer,
+			&p.Title, &p.Content, &p.HTML, &p.StatusCode, &jsonOutlinks, &jsonFields,
+			&p.Description, &jsonKeywords, &p.Language, &jsonHeadings, &p.PublishedAt, &jsonMetadata,
+			&p.MainContent, &p.ContentType, &jsonTags); err != nil {
+			return err
+		}
+		for _, col := range []struct {
+			data []byte
+			dst  any
+		}{
+			{jsonOutlinks, &p.Outlinks},
+			{jsonFields, &p.Fields},
+			{jsonKeywords, &p.Keywords},
+			{jsonHeadings, &p.Headings},
+			{jsonMetadata, &p.Metadata},
+			{jsonTags, &p.Tags},
+		} {
+			if err := scanJSON(col.data, col.dst); err != nil {
+				return err
+			}
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *PostgresStorage) Stats(ctx context.Context) (Stats, error) {
+	var st Stats
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(DISTINCT substring(normalized_url from '^[a-zA-Z]+://([^/:?#]+)')),
+			(SELECT COUNT(*) FROM sitemaps),
+			(SELECT COUNT(*) FROM feeds),
+			MIN(timestamp),
+			MAX(timestamp)
+		FROM pages`,
+	).Scan(&st.Pages, &st.Hosts, &st.Sitemaps, &st.Feeds, &st.FirstCrawled, &st.LastCrawled)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(status_code, 0), COUNT(*)
+		FROM pages
+		GROUP BY 1
+		ORDER BY 1`)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sc StatusCount
+		if err := rows.Scan(&sc.StatusCode, &sc.Count); err != nil {
+			return Stats{}, err
+		}
+		st.StatusCodes = append(st.StatusCodes, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, err
+	}
+
+	cutoffs, err := s.db.QueryContext(ctx, `
+		SELECT host, reason, pages, bytes, cut_at
+		FROM host_cutoffs
+		ORDER BY cut_at DESC
+		LIMIT $1`,
+		statsCutoffs,
+	)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer cutoffs.Close()
+
+	for cutoffs.Next() {
+		var c Cutoff
+		if err := cutoffs.Scan(&c.Host, &c.Reason, &c.Pages, &c.Bytes, &c.CutAt); err != nil {
+			return Stats{}, err
+		}
+		st.Cutoffs = append(st.Cutoffs, c)
+	}
+
+	return st, cutoffs.Err()
+}
+
+// contentType defaults pages saved without a content type to HTML, which is
+// all the crawler stored before content handlers existed.
+func contentType(p Page) string {
+	if p.ContentType == "" {
+		return "text/html"
+	}
+	return p.ContentType
+}
+
+// nullableJSON encodes v for a JSONB column, storing NULL rather than an
+// empty object or array when empty is set.
+func nullableJSON(v any, empty bool) (any, error) {
+	if empty {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func scanJSON(data []byte, dst any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, dst)
+}
+
 func (s *PostgresStorage) Close() error {
 	return s.db.Close()
 }
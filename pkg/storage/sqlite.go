@@ -0,0 +1,536 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/devraulu/crowlr/pkg/lang"
+)
+
+// insertPageSQLite inserts the pageColumns of a page.
+var insertPageSQLite = `INSERT INTO pages (` + strings.Join(pageColumns, ", ") + `)
+	VALUES (?` + strings.Repeat(", ?", len(pageColumns)-1) + `)`
+
+// SQLiteStorage stores everything in one SQLite file, with an FTS5 index of
+// the pages for Search. Open it with OpenDB.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(db *sql.DB) *SQLiteStorage {
+	return &SQLiteStorage{db: db}
+}
+
+func (s *SQLiteStorage) SavePage(ctx context.Context, p Page) error {
+	values, err := sqlitePageValues(p)
+	if err != nil {
+		return err
+	}
+
+	var id int
+	if err := s.db.QueryRowContext(ctx, insertPageSQLite+` RETURNING id`, values...).Scan(&id); err != nil {
+		return err
+	}
+
+	slog.Info("saved page", "id", id)
+	return nil
+}
+
+// SavePages stores pages in one transaction, all or none of them.
+func (s *SQLiteStorage) SavePages(ctx context.Context, pages []Page) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, insertPageSQLite)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range pages {
+		values, err := sqlitePageValues(p)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("saved pages", slog.Int("count", len(pages)))
+	return nil
+}
+
+// sqlitePageValues returns pageValues with JSON as text, which SQLite's JSON
+// functions expect; []byte would be stored as a blob.
+func sqlitePageValues(p Page) ([]any, error) {
+	values, err := pageValues(p)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+	return values, nil
+}
+
+func (s *SQLiteStorage) SaveSitemap(ctx context.Context, sm Sitemap) error {
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO sitemaps (url, last_checked, status_code, content)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE
+		SET last_checked = excluded.last_checked, status_code = excluded.status_code, content = excluded.content
+		RETURNING id`,
+		sm.URL, sm.LastChecked, sm.StatusCode, sm.Content,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("saved sitemap", "id", id)
+	return nil
+}
+
+func (s *SQLiteStorage) SaveFeed(ctx context.Context, f Feed) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO feeds (url, site_url, title, discovered_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (url) DO NOTHING`,
+		f.URL, f.SiteURL, f.Title, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("saved feed", "url", f.URL, "site_url", f.SiteURL)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) DueFeeds(ctx context.Context, polledBefore time.Time, limit int) ([]Feed, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, url, COALESCE(site_url, ''), COALESCE(title, ''), discovered_at, last_polled, last_entry_at,
+			COALESCE(etag, ''), COALESCE(last_modified, ''), COALESCE(status_code, 0), error_count
+		FROM feeds
+		WHERE last_polled IS NULL OR last_polled < ?
+		ORDER BY last_polled NULLS FIRST
+		LIMIT ?`,
+		polledBefore, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []Feed
+	for rows.Next() {
+		var f Feed
+		if err := rows.Scan(&f.ID, &f.URL, &f.SiteURL, &f.Title, &f.DiscoveredAt, &f.LastPolled, &f.LastEntryAt,
+			&f.ETag, &f.LastModified, &f.StatusCode, &f.ErrorCount); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+func (s *SQLiteStorage) UpdateFeed(ctx context.Context, f Feed) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE feeds
+		SET title = COALESCE(NULLIF(?2, ''), title), last_polled = ?3, last_entry_at = ?4,
+			etag = ?5, last_modified = ?6, status_code = ?7, error_count = ?8
+		WHERE url = ?1`,
+		f.URL, f.Title, f.LastPolled, f.LastEntryAt, f.ETag, f.LastModified, f.StatusCode, f.ErrorCount,
+	)
+	return err
+}
+
+func (s *SQLiteStorage) SaveCutoff(ctx context.Context, c Cutoff) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO host_cutoffs (host, reason, pages, bytes, cut_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (host) DO UPDATE
+		SET reason = excluded.reason, pages = excluded.pages, bytes = excluded.bytes, cut_at = excluded.cut_at`,
+		c.Host, c.Reason, c.Pages, c.Bytes, c.CutAt,
+	)
+	return err
+}
+
+func (s *SQLiteStorage) SaveQuarantine(ctx context.Context, q Quarantine) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO quarantined_patterns (host, pattern, reason, example, urls, quarantined_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (host, pattern) DO NOTHING`,
+		q.Host, q.Pattern, q.Reason, q.Example, q.URLs, q.QuarantinedAt,
+	)
+	return err
+}
+
+func (s *SQLiteStorage) Quarantines(ctx context.Context) ([]Quarantine, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT host, pattern, reason, example, urls, quarantined_at
+		FROM quarantined_patterns
+		ORDER BY quarantined_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var qs []Quarantine
+	for rows.Next() {
+		var q Quarantine
+		if err := rows.Scan(&q.Host, &q.Pattern, &q.Reason, &q.Example, &q.URLs, &q.QuarantinedAt); err != nil {
+			return nil, err
+		}
+		qs = append(qs, q)
+	}
+	return qs, rows.Err()
+}
+
+func (s *SQLiteStorage) SaveCommand(ctx context.Context, kind, arg string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO crawl_commands (kind, arg, created_at) VALUES (?, ?, ?)`, kind, arg, time.Now())
+	return err
+}
+
+func (s *SQLiteStorage) Commands(ctx context.Context, afterID int64) ([]Command, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, kind, arg, created_at
+		FROM crawl_commands
+		WHERE id > ?
+		ORDER BY id`,
+		afterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cmds []Command
+	for rows.Next() {
+		var c Command
+		if err := rows.Scan(&c.ID, &c.Kind, &c.Arg, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c)
+	}
+	return cmds, rows.Err()
+}
+
+func (s *SQLiteStorage) LastCommandID(ctx context.Context) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM crawl_commands`).Scan(&id)
+	return id, err
+}
+
+// Search matches query against the FTS5 index of the pages, ranked with
+// bm25 using the column weights of the Postgres tsvector. The query takes
+// the same syntax as in Postgres: quoted phrases, -excluded words and or.
+// A given language limits the results to pages in that language; all pages
+// share the same English stemmer, so the query's own language is only
+// detected to be reported.
+func (s *SQLiteStorage) Search(ctx context.Context, query, language string, limit int) (SearchResponse, error) {
+	slog.Debug("search query", "query", query, "language", language, "limit", limit)
+
+	match := ftsQuery(query)
+	if match == "" {
+		return SearchResponse{}, nil
+	}
+
+	tsConfig := ""
+	where := `pages_fts MATCH ?`
+	args := []any{match}
+	if language != "" {
+		tsConfig = TextSearchConfig(language)
+		where += ` AND pages.ts_config = ?`
+		args = append(args, tsConfig)
+	} else if detected := lang.Detect(query); detected != "" {
+		tsConfig = TextSearchConfig(detected)
+	}
+
+	var totalCount int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM pages_fts JOIN pages ON pages.id = pages_fts.rowid
+		WHERE `+where,
+		args...,
+	).Scan(&totalCount)
+	if err != nil {
+		slog.Error("search count query failed", "query", query, "err", err)
+		return SearchResponse{}, err
+	}
+
+	// snippet takes the main content when the page has one, like the
+	// Postgres headline; it returns the text unescaped, so matches are
+	// marked for markedHTML
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			pages.url,
+			COALESCE(pages.title, ''),
+			snippet(pages_fts, CASE WHEN COALESCE(pages.main_content, '') = '' THEN 3 ELSE 2 END, '`+markStart+`', '`+markStop+`', '…', 40) AS snippet,
+			-bm25(pages_fts, 10.0, 4.0, 2.0, 1.0) AS rank,
+			pages.fields,
+			COALESCE(pages.language, ''),
+			pages.published_at,
+			pages.content_type
+		FROM pages_fts JOIN pages ON pages.id = pages_fts.rowid
+		WHERE `+where+`
+		ORDER BY rank DESC
+		LIMIT ?`,
+		append(args, limit)...,
+	)
+	if err != nil {
+		slog.Error("search query failed", "query", query, "err", err)
+		return SearchResponse{}, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		var jsonFields sql.NullString
+		if err := rows.Scan(&r.URL, &r.Title, &r.Snippet, &r.Rank, &jsonFields, &r.Language, &r.PublishedAt, &r.ContentType); err != nil {
+			slog.Error("search scan failed", "query", query, "err", err)
+			return SearchResponse{}, err
+		}
+		if err := scanJSON([]byte(jsonFields.String), &r.Fields); err != nil {
+			return SearchResponse{}, err
+		}
+		r.Snippet = markedHTML(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("search rows iteration failed", "query", query, "err", err)
+		return SearchResponse{}, err
+	}
+
+	slog.Info("search complete", "query", query, "ts_config", tsConfig, "results", len(results), "total", totalCount)
+	return SearchResponse{
+		Results:    results,
+		TotalCount: totalCount,
+		Language:   tsConfig,
+	}, nil
+}
+
+// ftsQuery translates a web search style query into an FTS5 expression:
+// words and "quoted phrases" must all match, or separates alternatives and
+// a leading - excludes a word or phrase. Every term is quoted, so FTS5
+// syntax in the query is searched for literally. It returns "" when nothing
+// is left to match.
+func ftsQuery(query string) string {
+	var groups [][]string
+	var group, excluded []string
+
+	for len(query) > 0 {
+		query = strings.TrimLeftFunc(query, unicode.IsSpace)
+		if query == "" {
+			break
+		}
+
+		negate := false
+		if strings.HasPrefix(query, "-") {
+			negate = true
+			query = query[1:]
+		}
+
+		var term string
+		quoted := strings.HasPrefix(query, `"`)
+		if quoted {
+			var ok bool
+			if term, query, ok = strings.Cut(query[1:], `"`); !ok {
+				query = ""
+			}
+		} else {
+			end := strings.IndexFunc(query, unicode.IsSpace)
+			if end < 0 {
+				end = len(query)
+			}
+			term, query = query[:end], query[end:]
+		}
+
+		if !quoted && !negate && strings.EqualFold(term, "or") {
+			if len(group) > 0 {
+				groups = append(groups, group)
+				group = nil
+			}
+			continue
+		}
+		if !strings.ContainsFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) {
+			continue
+		}
+
+		term = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if negate {
+			excluded = append(excluded, term)
+		} else {
+			group = append(group, term)
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	if len(groups) == 0 {
+		return ""
+	}
+
+	alternatives := make([]string, len(groups))
+	for i, g := range groups {
+		alternatives[i] = "(" + strings.Join(g, " ") + ")"
+	}
+	expr := "(" + strings.Join(alternatives, " OR ") + ")"
+	for _, term := range excluded {
+		expr += " NOT " + term
+	}
+	return expr
+}
+
+func (s *SQLiteStorage) EachPage(ctx context.Context, fn func(Page) error) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, url, normalized_url, timestamp, last_modified, COALESCE(referrer, ''),
+			COALESCE(title, ''), COALESCE(content, ''), COALESCE(html, ''), COALESCE(status_code, 0), outlinks, fields,
+			COALESCE(description, ''), keywords, COALESCE(language, ''), headings, published_at, metadata,
+			COALESCE(main_content, ''), content_type, tags
+		FROM pages
+		ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Page
+		var timestamp *time.Time
+		var jsonOutlinks, jsonFields, jsonKeywords, jsonHeadings, jsonMetadata, jsonTags sql.NullString
+		if err := rows.Scan(&p.ID, &p.RawURL, &p.URL, &timestamp, &p.LastModified, &p.Referrer,
+			&p.Title, &p.Content, &p.HTML, &p.StatusCode, &jsonOutlinks, &jsonFields,
+			&p.Description, &jsonKeywords, &p.Language, &jsonHeadings, &p.PublishedAt, &jsonMetadata,
+			&p.MainContent, &p.ContentType, &jsonTags); err != nil {
+			return err
+		}
+		if timestamp != nil {
+			p.Timestamp = *timestamp
+		}
+		for _, col := range []struct {
+			data sql.NullString
+			dst  any
+		}{
+			{jsonOutlinks, &p.Outlinks},
+			{jsonFields, &p.Fields},
+			{jsonKeywords, &p.Keywords},
+			{jsonHeadings, &p.Headings},
+			{jsonMetadata, &p.Metadata},
+			{jsonTags, &p.Tags},
+		} {
+			if err := scanJSON([]byte(col.data.String), col.dst); err != nil {
+				return err
+			}
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLiteStorage) Stats(ctx context.Context) (Stats, error) {
+	var st Stats
+	// aggregates lose the TIMESTAMP type, so the first and last crawl
+	// times come back as unix nanoseconds
+	var first, last sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			(SELECT COUNT(DISTINCT host) FROM (
+				SELECT substr(authority, 1, instr(authority || ':', ':') - 1) AS host
+				FROM (
+					SELECT substr(rest, 1, instr(rest || '/', '/') - 1) AS authority
+					FROM (
+						SELECT replace(replace(substr(normalized_url, instr(normalized_url, '://') + 3), '?', '/'), '#', '/') AS rest
+						FROM pages
+					)
+				)
+			)),
+			(SELECT COUNT(*) FROM sitemaps),
+			(SELECT COUNT(*) FROM feeds),
+			MIN(timestamp),
+			MAX(timestamp)
+		FROM pages`,
+	).Scan(&st.Pages, &st.Hosts, &st.Sitemaps, &st.Feeds, &first, &last)
+	if err != nil {
+		return Stats{}, err
+	}
+	st.FirstCrawled, st.LastCrawled = unixNanoTime(first), unixNanoTime(last)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(status_code, 0), COUNT(*)
+		FROM pages
+		GROUP BY 1
+		ORDER BY 1`)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sc StatusCount
+		if err := rows.Scan(&sc.StatusCode, &sc.Count); err != nil {
+			return Stats{}, err
+		}
+		st.StatusCodes = append(st.StatusCodes, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, err
+	}
+	// the only connection must be free for the next query
+	rows.Close()
+
+	cutoffs, err := s.db.QueryContext(ctx, `
+		SELECT host, reason, pages, bytes, cut_at
+		FROM host_cutoffs
+		ORDER BY cut_at DESC
+		LIMIT ?`,
+		statsCutoffs,
+	)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer cutoffs.Close()
+
+	for cutoffs.Next() {
+		var c Cutoff
+		if err := cutoffs.Scan(&c.Host, &c.Reason, &c.Pages, &c.Bytes, &c.CutAt); err != nil {
+			return Stats{}, err
+		}
+		st.Cutoffs = append(st.Cutoffs, c)
+	}
+	return st, cutoffs.Err()
+}
+
+func unixNanoTime(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := time.Unix(0, n.Int64)
+	return &t
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
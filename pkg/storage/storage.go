@@ -2,6 +2,9 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"html"
+	"strings"
 	"time"
 )
 
@@ -14,9 +17,31 @@ type Page struct {
 	LastModified *time.Time
 	Title        string
 	Content      string
+	MainContent  string
 	HTML         string
+	ContentType  string
 	StatusCode   int
 	Outlinks     []string
+	Fields       map[string]string
+	Description  string
+	Keywords     []string
+	Language     string
+	Headings     []string
+	PublishedAt  *time.Time
+	Metadata     Metadata
+	// Tags are inherited from the seed the page was reached from.
+	Tags []string
+}
+
+// Metadata holds the structured page metadata that has no column of its own.
+type Metadata struct {
+	OpenGraph map[string]string `json:"opengraph,omitempty"`
+	Twitter   map[string]string `json:"twitter,omitempty"`
+	JSONLD    []json.RawMessage `json:"json_ld,omitempty"`
+}
+
+func (m Metadata) IsZero() bool {
+	return len(m.OpenGraph) == 0 && len(m.Twitter) == 0 && len(m.JSONLD) == 0
 }
 
 type Sitemap struct {
@@ -26,21 +51,140 @@ type Sitemap struct {
 	Content     string
 }
 
+type Feed struct {
+	ID           int
+	URL          string
+	SiteURL      string
+	Title        string
+	DiscoveredAt time.Time
+	LastPolled   *time.Time
+	LastEntryAt  *time.Time
+	ETag         string
+	LastModified string
+	StatusCode   int
+	ErrorCount   int
+}
+
+// Cutoff records a host that stopped being crawled because it used up its
+// budget.
+type Cutoff struct {
+	Host   string
+	Reason string
+	Pages  int
+	Bytes  int64
+	CutAt  time.Time
+}
+
+// Quarantine records a URL pattern of a host that was taken for a crawler
+// trap. URLs is how many URLs of the pattern had been accepted by then.
+type Quarantine struct {
+	Host          string
+	Pattern       string
+	Reason        string
+	Example       string
+	URLs          int
+	QuarantinedAt time.Time
+}
+
+// Command kinds for steering running crawls through crawl_commands.
+const (
+	CommandSeed  = "seed"
+	CommandBlock = "block"
+)
+
+// Command asks every running crawl to queue a seed URL or block a host.
+type Command struct {
+	ID        int64
+	Kind      string
+	Arg       string
+	CreatedAt time.Time
+}
+
 type SearchResult struct {
-	URL     string
-	Title   string
-	Snippet string
-	Rank    float64
+	URL   string
+	Title string
+	// Snippet is HTML: the page's text escaped, with matches in <mark>
+	Snippet     string
+	Rank        float64
+	Fields      map[string]string
+	Language    string
+	PublishedAt *time.Time
+	ContentType string
+}
+
+// Highlighting markers stand in for <mark> and </mark> in snippets made by
+// the database, which returns the crawled text unescaped. They are private
+// use characters, which pages practically never contain.
+const (
+	markStart = "\ue000"
+	markStop  = "\ue001"
+)
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// markedHTML escapes a snippet highlighted with markStart and markStop and
+// turns the markers into <mark> tags.
+func markedHTML(snippet string) string {
+	return markReplacer.Replace(html.EscapeString(snippet))
 }
 
 type SearchResponse struct {
 	Results    []SearchResult
 	TotalCount int
+	// Language is the text search configuration the query was parsed with,
+	// or "" when each page was matched using its own.
+	Language string
+}
+
+type StatusCount struct {
+	StatusCode int
+	Count      int
+}
+
+type Stats struct {
+	Pages        int
+	Hosts        int
+	Sitemaps     int
+	Feeds        int
+	FirstCrawled *time.Time
+	LastCrawled  *time.Time
+	StatusCodes  []StatusCount
+	// Cutoffs are the most recently cut off hosts
+	Cutoffs []Cutoff
 }
 
 type Storage interface {
 	SavePage(ctx context.Context, p Page) error
+	// SavePages stores several pages in one batch.
+	SavePages(ctx context.Context, pages []Page) error
 	SaveSitemap(ctx context.Context, s Sitemap) error
-	Search(ctx context.Context, query string, limit int) (SearchResponse, error)
+	// SaveFeed records a discovered feed. Feeds that are already known are
+	// left untouched.
+	SaveFeed(ctx context.Context, f Feed) error
+	// DueFeeds returns up to limit feeds never polled or last polled before
+	// polledBefore, least recently polled first.
+	DueFeeds(ctx context.Context, polledBefore time.Time, limit int) ([]Feed, error)
+	// UpdateFeed stores the outcome of a poll, matched by URL.
+	UpdateFeed(ctx context.Context, f Feed) error
+	// SaveCutoff records why a host was cut off, replacing any earlier
+	// record for it.
+	SaveCutoff(ctx context.Context, c Cutoff) error
+	// SaveQuarantine records a suspected crawler trap. A pattern that is
+	// already recorded is left as it is.
+	SaveQuarantine(ctx context.Context, q Quarantine) error
+	// Quarantines lists recorded traps, most recent first.
+	Quarantines(ctx context.Context) ([]Quarantine, error)
+	SaveCommand(ctx context.Context, kind, arg string) error
+	// Commands returns the commands after afterID, oldest first.
+	Commands(ctx context.Context, afterID int64) ([]Command, error)
+	// LastCommandID returns the ID of the newest command, 0 if there is none.
+	LastCommandID(ctx context.Context) (int64, error)
+	// Search runs a full-text query. language may be an ISO 639-1 tag or a
+	// text search configuration name; "" detects it from the query.
+	Search(ctx context.Context, query, language string, limit int) (SearchResponse, error)
+	// EachPage calls fn for every stored page in id order, stopping at the
+	// first error fn returns.
+	EachPage(ctx context.Context, fn func(Page) error) error
+	Stats(ctx context.Context) (Stats, error)
 	Close() error
 }
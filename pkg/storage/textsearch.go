@@ -0,0 +1,57 @@
+package storage
+
+import "github.com/devraulu/crowlr/pkg/lang"
+
+// DefaultTextSearchConfig is used for pages and queries whose language is
+// unknown or has no matching Postgres text search configuration.
+const DefaultTextSearchConfig = "simple"
+
+// textSearchConfigs maps ISO 639-1 codes to the text search configurations
+// that ship with Postgres 14+.
+var textSearchConfigs = map[string]string{
+	"ar": "arabic",
+	"hy": "armenian",
+	"eu": "basque",
+	"ca": "catalan",
+	"da": "danish",
+	"nl": "dutch",
+	"en": "english",
+	"fi": "finnish",
+	"fr": "french",
+	"de": "german",
+	"el": "greek",
+	"hi": "hindi",
+	"hu": "hungarian",
+	"id": "indonesian",
+	"ga": "irish",
+	"it": "italian",
+	"lt": "lithuanian",
+	"ne": "nepali",
+	"no": "norwegian",
+	"nb": "norwegian",
+	"nn": "norwegian",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sr": "serbian",
+	"es": "spanish",
+	"sv": "swedish",
+	"ta": "tamil",
+	"tr": "turkish",
+	"yi": "yiddish",
+}
+
+// TextSearchConfig returns the Postgres text search configuration for a
+// language tag such as "en-US", or for a configuration name such as
+// "spanish". Unknown languages get DefaultTextSearchConfig.
+func TextSearchConfig(language string) string {
+	if cfg, ok := textSearchConfigs[lang.Base(language)]; ok {
+		return cfg
+	}
+	for _, cfg := range textSearchConfigs {
+		if cfg == language {
+			return cfg
+		}
+	}
+	return DefaultTextSearchConfig
+}
@@ -0,0 +1,84 @@
+package frontier
+
+import (
+	"time"
+
+	"github.com/devraulu/crowlr/pkg/config"
+)
+
+const (
+	// statsWeight is how much each fetch moves the latency and error rate
+	// averages.
+	statsWeight = 0.3
+	// backoffFactor multiplies the delay after a server error or timeout.
+	backoffFactor = 2
+	// minBackoff is the smallest delay after a server error or timeout.
+	minBackoff = time.Second
+	// maxErrorRate stops a host's delay from shrinking while errors are
+	// this frequent.
+	maxErrorRate = 0.25
+)
+
+// HostStats are the recent fetch results of a politeness group.
+type HostStats struct {
+	// Delay is the current politeness delay; valid once Samples > 0.
+	Delay time.Duration
+	// Latency is a moving average of response times.
+	Latency time.Duration
+	// ErrorRate is a moving average of the share of fetches that failed
+	// with a 5xx, 429 or no response.
+	ErrorRate float64
+	Samples   int
+}
+
+// Throttle adapts each politeness group's delay to how the server copes,
+// AutoThrottle-style: successful responses move the delay halfway towards
+// the average latency, so fast servers are crawled faster, while 5xx, 429
+// and timeouts double it. The delay stays within Min and Max.
+type Throttle struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// NewThrottle returns the throttle of cfg, or nil when politeness.adaptive is
+// off.
+func NewThrottle(cfg config.PolitenessConfig) *Throttle {
+	if !cfg.Adaptive {
+		return nil
+	}
+	return &Throttle{Min: cfg.MinDelay.Duration, Max: cfg.MaxDelay.Duration}
+}
+
+// Update returns s after a fetch that took latency and returned statusCode,
+// 0 meaning no response. The delay starts from defaultDelay.
+func (t *Throttle) Update(s HostStats, defaultDelay, latency time.Duration, statusCode int) HostStats {
+	delay := s.Delay
+	if s.Samples == 0 {
+		delay = defaultDelay
+		s.Latency = latency
+	}
+
+	failed := statusCode == 0 || statusCode == 429 || statusCode >= 500
+	errSample := 0.0
+	if failed {
+		errSample = 1
+	}
+	s.ErrorRate += statsWeight * (errSample - s.ErrorRate)
+	if statusCode != 0 {
+		s.Latency += time.Duration(statsWeight * float64(latency-s.Latency))
+	}
+	s.Samples++
+
+	switch {
+	case failed:
+		delay = max(delay*backoffFactor, minBackoff)
+	case statusCode < 400:
+		target := (delay + s.Latency) / 2
+		if target > delay || s.ErrorRate < maxErrorRate {
+			delay = target
+		}
+	}
+
+	s.Delay = min(max(delay, t.Min), t.Max)
+	return s
+}
@@ -0,0 +1,208 @@
+package frontier
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/devraulu/crowlr/pkg/clock"
+	"github.com/devraulu/crowlr/pkg/config"
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+// TrapDetector rejects URLs that look like crawler traps: calendars,
+// faceted navigation, session IDs and other endless URL spaces. Single URLs
+// are rejected for being too long, too deep, having too many query
+// parameters or repeating path segments, without affecting other URLs.
+// Beyond that, URLs are grouped into patterns per host (digits and IDs
+// wildcarded, query values dropped) and a pattern that keeps producing new
+// URLs is quarantined.
+type TrapDetector struct {
+	cfg   config.TrapsConfig
+	clock clock.Clock
+
+	mu          sync.Mutex
+	counts      map[string]int
+	quarantined map[string]bool
+}
+
+// NewTrapDetector returns a detector for cfg that dates quarantines with cl.
+func NewTrapDetector(cfg config.TrapsConfig, cl clock.Clock) *TrapDetector {
+	return &TrapDetector{
+		cfg:         cfg,
+		clock:       cl,
+		counts:      make(map[string]int),
+		quarantined: make(map[string]bool),
+	}
+}
+
+// Check returns why rawURL should not be crawled, or "" if it may be. Only
+// URLs reported through Accepted count towards a pattern's limit, and only
+// that limit quarantines a pattern. When the URL puts its pattern into
+// quarantine, that is returned too so it can be reported; later URLs of the
+// pattern are rejected without one.
+func (d *TrapDetector) Check(rawURL string) (string, *storage.Quarantine) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "unparseable url", nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+	pattern := URLPattern(u)
+	key := host + " " + pattern
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.quarantined[key] {
+		return "quarantined pattern", nil
+	}
+
+	// a single odd URL says nothing about the rest of its pattern
+	if reason := d.inspect(rawURL, u); reason != "" {
+		return reason, nil
+	}
+
+	max := d.cfg.MaxURLsPerPattern
+	if max <= 0 || d.counts[key] < max {
+		return "", nil
+	}
+	reason := fmt.Sprintf("more than %d urls match the pattern", max)
+
+	d.quarantined[key] = true
+	count := d.counts[key]
+	delete(d.counts, key)
+
+	return reason, &storage.Quarantine{
+		Host:          host,
+		Pattern:       pattern,
+		Reason:        reason,
+		Example:       rawURL,
+		URLs:          count,
+		QuarantinedAt: d.clock.Now(),
+	}
+}
+
+// Accepted counts rawURL, which passed Check and was new to the frontier,
+// towards its pattern's limit.
+func (d *TrapDetector) Accepted(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	key := strings.ToLower(u.Hostname()) + " " + URLPattern(u)
+
+	d.mu.Lock()
+	d.counts[key]++
+	d.mu.Unlock()
+}
+
+// inspect applies the single-URL heuristics.
+func (d *TrapDetector) inspect(rawURL string, u *url.URL) string {
+	if max := d.cfg.MaxURLLength; max > 0 && len(rawURL) > max {
+		return fmt.Sprintf("url longer than %d characters", max)
+	}
+
+	if max := d.cfg.MaxQueryParams; max > 0 {
+		if n := len(u.Query()); n > max {
+			return fmt.Sprintf("%d query parameters, more than %d", n, max)
+		}
+	}
+
+	segments := pathSegments(u)
+	if max := d.cfg.MaxPathDepth; max > 0 && len(segments) > max {
+		return fmt.Sprintf("path deeper than %d segments", max)
+	}
+
+	if max := d.cfg.MaxSegmentRepeats; max > 0 {
+		seen := make(map[string]int)
+		for _, s := range segments {
+			seen[s]++
+			if seen[s] > max {
+				return fmt.Sprintf("path segment %q repeated more than %d times", s, max)
+			}
+		}
+	}
+
+	return ""
+}
+
+// URLPattern generalizes a URL's path and query: numbers become N, long
+// hex or UUID-like segments become X and query values are dropped, so
+// /events/2024/05/12?view=day and /events/2023/11/02?view=week share the
+// pattern /events/N/N/N?view.
+func URLPattern(u *url.URL) string {
+	segments := pathSegments(u)
+	for i, s := range segments {
+		segments[i] = generalizeSegment(s)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("/")
+	sb.WriteString(strings.Join(segments, "/"))
+
+	if u.RawQuery != "" {
+		keys := make([]string, 0)
+		for k := range u.Query() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sb.WriteString("?")
+		sb.WriteString(strings.Join(keys, "&"))
+	}
+
+	return sb.String()
+}
+
+func pathSegments(u *url.URL) []string {
+	var segments []string
+	for _, s := range strings.Split(u.EscapedPath(), "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func generalizeSegment(s string) string {
+	if isIDLike(s) {
+		return "X"
+	}
+
+	var sb strings.Builder
+	inDigits := false
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			if !inDigits {
+				sb.WriteString("N")
+			}
+			inDigits = true
+			continue
+		}
+		inDigits = false
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// isIDLike reports whether s looks like a hash, UUID or session token: at
+// least 16 characters of hex digits and dashes with some digits in them.
+func isIDLike(s string) bool {
+	if len(s) < 16 {
+		return false
+	}
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r >= 'a' && r <= 'f', r >= 'A' && r <= 'F', r == '-':
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+
+	"github.com/devraulu/crowlr/pkg/storage"
+)
+
+//go:embed templates/*
+var templates embed.FS
+
+//go:embed static/*
+var staticFiles embed.FS
+
+const searchLimit = 500
+
+type SearchResults struct {
+	Results  []storage.SearchResult
+	Count    int
+	Query    string
+	Language string
+}
+
+type Server struct {
+	store storage.Storage
+	tmpl  *template.Template
+	mux   *http.ServeMux
+}
+
+func NewServer(store storage.Storage) (*Server, error) {
+	funcMap := template.FuncMap{
+		"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+	}
+	tmpl, err := template.New("").Funcs(funcMap).ParseFS(templates, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	staticFS, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		store: store,
+		tmpl:  tmpl,
+		mux:   http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	slog.Info("request", "method", r.Method, "path", r.URL.Path)
+	s.tmpl.ExecuteTemplate(w, "index.html", nil)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	language := r.URL.Query().Get("lang")
+	if query == "" {
+		s.tmpl.ExecuteTemplate(w, "results.html", nil)
+		return
+	}
+
+	slog.Info("search", slog.String("query", query), slog.String("lang", language))
+
+	searchResponse, err := s.store.Search(r.Context(), query, language, searchLimit)
+	if err != nil {
+		slog.Error("search failed", slog.String("query", query), slog.Any("err", err))
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+
+	searchResults := SearchResults{
+		Results:  searchResponse.Results,
+		Count:    searchResponse.TotalCount,
+		Query:    query,
+		Language: searchResponse.Language,
+	}
+
+	slog.Info("search complete", slog.String("query", query), slog.Int("results", len(searchResponse.Results)), slog.Int("total", searchResponse.TotalCount))
+	s.tmpl.ExecuteTemplate(w, "results.html", searchResults)
+}